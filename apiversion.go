@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api"
+	"github.com/docker/docker/api/types/versions"
+	"github.com/docker/docker/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// apiVersions observes the version of the Docker API of the daemon from the
+// API-Version header of its responses, next to the version negotiated by the
+// Docker client at startup. When the daemon is upgraded or downgraded, the
+// version is negotiated again like by the Docker client, and the requests of
+// the client are sent with the new version, unless the version is fixed with
+// DOCKER_API_VERSION.
+type apiVersions struct {
+	docker *client.Client
+	fixed  bool
+
+	mu            sync.Mutex
+	serverVersion string
+	// negotiated is the version negotiated after the daemon changed, if any
+	negotiated string
+}
+
+func newAPIVersions(docker *client.Client, fixed bool) *apiVersions {
+	return &apiVersions{docker: docker, fixed: fixed}
+}
+
+// current returns the version of the requests of the Docker client.
+func (v *apiVersions) current() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.currentLocked()
+}
+
+func (v *apiVersions) currentLocked() string {
+	if v.negotiated != "" {
+		return v.negotiated
+	}
+	return v.docker.ClientVersion()
+}
+
+// observe records the API version of a response of the daemon, negotiating
+// the version again when it changed.
+func (v *apiVersions) observe(header http.Header) {
+	serverVersion := header.Get("API-Version")
+	if serverVersion == "" {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if serverVersion == v.serverVersion {
+		return
+	}
+	previous := v.serverVersion
+	v.serverVersion = serverVersion
+	if previous == "" {
+		return
+	}
+	if v.fixed {
+		log.Printf("Docker API version changed from %s to %s, still using %s set in DOCKER_API_VERSION", previous, serverVersion, v.currentLocked())
+		return
+	}
+	// the highest version supported by both, as negotiated by the client
+	negotiated := api.DefaultVersion
+	if versions.LessThan(serverVersion, negotiated) {
+		negotiated = serverVersion
+	}
+	log.Printf("Docker API version changed from %s to %s, now using %s", previous, serverVersion, negotiated)
+	v.negotiated = negotiated
+}
+
+// rewrite returns a request of the Docker client sent with the version
+// negotiated after the daemon changed, if it differs from the version of the
+// client.
+func (v *apiVersions) rewrite(req *http.Request) *http.Request {
+	current := v.current()
+	clientVersion := v.docker.ClientVersion()
+	prefix := "/v" + clientVersion + "/"
+	if current == clientVersion || !strings.HasPrefix(req.URL.Path, prefix) {
+		return req
+	}
+	req = req.Clone(req.Context())
+	req.URL.Path = "/v" + current + "/" + strings.TrimPrefix(req.URL.Path, prefix)
+	req.URL.RawPath = ""
+	return req
+}
+
+func (v *apiVersions) collect(ch chan<- prometheus.Metric) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.serverVersion == "" {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+		"docker_engine_api_version_info", "",
+		[]string{"server_version", "client_version"}, nil),
+		prometheus.GaugeValue,
+		1,
+		v.serverVersion, v.currentLocked())
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// auditTransport logs every request made to the Docker API with its outcome
+// and duration, and refuses the requests other than GET and HEAD so that the
+// exporter cannot change the state of the daemon. The duration of streaming
+// requests, such as events, is the time until the response headers.
+type auditTransport struct {
+	http.RoundTripper
+	logger *log.Logger
+}
+
+// newAuditTransport creates an audit transport logging to path, or to the
+// standard error if empty.
+func newAuditTransport(next http.RoundTripper, path string) (*auditTransport, error) {
+	var out io.Writer = os.Stderr
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	return &auditTransport{
+		RoundTripper: next,
+		logger:       log.New(out, "audit: ", log.LstdFlags|log.Lmicroseconds),
+	}, nil
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		err := fmt.Errorf("refused %s request in audit mode", req.Method)
+		t.logger.Printf("%s %s refused", req.Method, req.URL.RequestURI())
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := t.RoundTripper.RoundTrip(req)
+	duration := time.Since(start).Round(time.Microsecond)
+	if err != nil {
+		t.logger.Printf("%s %s error %v: %v", req.Method, req.URL.RequestURI(), duration, err)
+		return resp, err
+	}
+	t.logger.Printf("%s %s %d %v", req.Method, req.URL.RequestURI(), resp.StatusCode, duration)
+	return resp, err
+}
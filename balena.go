@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+var balenaLabelNames = []string{"service", "release"}
+
+// balenaLabels returns the values of balenaLabelNames for a container
+// managed by the balena supervisor, which are empty for other containers.
+//
+// Supervised containers are named "<service>_<image_id>_<release_id>", with
+// an optional "_<commit>" suffix on recent supervisor versions.
+func balenaLabels(name string, container *types.Container) []string {
+	if container.Labels["io.balena.supervised"] != "true" {
+		return []string{"", ""}
+	}
+	service := container.Labels["io.balena.service-name"]
+	release := ""
+	if parts := strings.Split(name, "_"); len(parts) >= 3 {
+		if service == "" {
+			service = parts[0]
+		}
+		release = parts[2]
+	}
+	return []string{service, release}
+}
+
+// isBalenaSupervisor reports whether a container is the balena supervisor
+// itself, or one of its helper containers.
+func isBalenaSupervisor(name string, container *types.Container) bool {
+	switch name {
+	case "balena_supervisor", "resin_supervisor":
+		return true
+	}
+	return container.Labels["io.balena.private.supervisor"] != "" ||
+		strings.Contains(container.Image, "balena-supervisor") ||
+		strings.Contains(container.Image, "resin-supervisor")
+}
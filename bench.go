@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// benchCommand runs collection rounds against the Docker daemon and reports
+// their duration, Docker API requests, and allocations.
+func benchCommand(e *exporter, args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	rounds := flags.Int("rounds", 10, "number of collection rounds")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *rounds <= 0 {
+		fmt.Fprintln(os.Stderr, "rounds must be positive")
+		return 2
+	}
+
+	durations := make([]time.Duration, *rounds)
+	var metrics, requests, allocs, bytes uint64
+	for i := range durations {
+		ch := make(chan prometheus.Metric)
+		done := make(chan struct{})
+		go func() {
+			for range ch {
+				metrics++
+			}
+			close(done)
+		}()
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		requestsBefore := e.transport.requests.Load()
+		start := time.Now()
+
+		e.collect(context.Background(), ch, collectOptions{})
+
+		durations[i] = time.Since(start)
+		requests += e.transport.requests.Load() - requestsBefore
+		runtime.ReadMemStats(&after)
+		allocs += after.Mallocs - before.Mallocs
+		bytes += after.TotalAlloc - before.TotalAlloc
+
+		close(ch)
+		<-done
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	n := uint64(*rounds)
+	fmt.Printf("rounds:             %d\n", *rounds)
+	fmt.Printf("duration p50:       %v\n", percentile(durations, 0.50))
+	fmt.Printf("duration p95:       %v\n", percentile(durations, 0.95))
+	fmt.Printf("metrics/round:      %d\n", metrics/n)
+	fmt.Printf("api requests/round: %d\n", requests/n)
+	fmt.Printf("allocs/round:       %d\n", allocs/n)
+	fmt.Printf("bytes/round:        %d\n", bytes/n)
+	return 0
+}
+
+// percentile returns the p-th percentile of sorted durations using the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p*float64(len(sorted)) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
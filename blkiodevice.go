@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// deviceNamesRefreshInterval is the minimum interval between reloads of the
+// block device names, reloaded when a device is not found.
+const deviceNamesRefreshInterval = time.Minute
+
+// deviceNames maps the major and minor numbers of block devices to their
+// name, read from the partitions file of the /proc of the host.
+type deviceNames struct {
+	path string
+
+	mu       sync.Mutex
+	names    map[string]string
+	loadedAt time.Time
+}
+
+func newDeviceNames(procPath string) *deviceNames {
+	return &deviceNames{path: filepath.Join(procPath, "partitions")}
+}
+
+// name returns the name of a device, such as "sda", or its major and minor
+// numbers such as "8:0" for devices missing from the partitions file.
+func (d *deviceNames) name(major, minor uint64) string {
+	key := fmt.Sprintf("%d:%d", major, minor)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if name, ok := d.names[key]; ok {
+		return name
+	}
+	if time.Since(d.loadedAt) >= deviceNamesRefreshInterval {
+		names, err := readPartitions(d.path)
+		d.loadedAt = time.Now()
+		if err == nil {
+			d.names = names
+		}
+		if name, ok := d.names[key]; ok {
+			return name
+		}
+	}
+	return key
+}
+
+// readPartitions parses a /proc/partitions file, with the major and minor
+// numbers, size, and name of a device on each line after the header.
+func readPartitions(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			continue
+		}
+		if _, err := strconv.ParseUint(fields[0], 10, 64); err != nil {
+			continue
+		}
+		names[fields[0]+":"+fields[1]] = fields[3]
+	}
+	return names, scanner.Err()
+}
+
+// collectBlkioDevices exports the bytes and operations read and written by a
+// container for each block device.
+func (e *exporter) collectBlkioDevices(m *containerMetrics, stats *types.StatsJSON) {
+	e.sendBlkioDevices(m, stats.BlkioStats.IoServiceBytesRecursive,
+		"docker_container_blkio_read_bytes_total", "docker_container_blkio_write_bytes_total")
+	e.sendBlkioDevices(m, stats.BlkioStats.IoServicedRecursive,
+		"docker_container_blkio_reads_total", "docker_container_blkio_writes_total")
+}
+
+// sendBlkioDevices exports the reads and writes of blkio stats entries for
+// each block device.
+func (e *exporter) sendBlkioDevices(m *containerMetrics, entries []types.BlkioStatEntry, readName, writeName string) {
+	type device struct{ major, minor uint64 }
+	reads := make(map[device]uint64)
+	writes := make(map[device]uint64)
+	for _, entry := range entries {
+		key := device{entry.Major, entry.Minor}
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			reads[key] += entry.Value
+		case "write":
+			writes[key] += entry.Value
+		}
+	}
+
+	devices := make([]device, 0, len(reads))
+	for key := range reads {
+		devices = append(devices, key)
+	}
+	for key := range writes {
+		if _, ok := reads[key]; !ok {
+			devices = append(devices, key)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].major != devices[j].major {
+			return devices[i].major < devices[j].major
+		}
+		return devices[i].minor < devices[j].minor
+	})
+	for _, key := range devices {
+		name := e.deviceNames.name(key.major, key.minor)
+		m.sendWithLabels(readName, prometheus.CounterValue, float64(reads[key]),
+			[]string{"device"},
+			name)
+		m.sendWithLabels(writeName, prometheus.CounterValue, float64(writes[key]),
+			[]string{"device"},
+			name)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// builderTracker counts the builder and prune events of the Docker daemon,
+// and the space reclaimed by prunes.
+type builderTracker struct {
+	builderEvents  *prometheus.CounterVec
+	prunes         *prometheus.CounterVec
+	reclaimedBytes *prometheus.CounterVec
+}
+
+func newBuilderTracker() *builderTracker {
+	return &builderTracker{
+		builderEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "docker_builder_events_total",
+		}, []string{"action"}),
+		prunes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "docker_prunes_total",
+		}, []string{"type"}),
+		reclaimedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "docker_prune_reclaimed_bytes_total",
+		}, []string{"type"}),
+	}
+}
+
+func (t *builderTracker) collectors() []prometheus.Collector {
+	return []prometheus.Collector{t.builderEvents, t.prunes, t.reclaimedBytes}
+}
+
+func (t *builderTracker) handleEvent(message events.Message) {
+	if message.Type == events.BuilderEventType {
+		t.builderEvents.WithLabelValues(message.Action).Inc()
+	}
+	if message.Action != "prune" {
+		return
+	}
+	t.prunes.WithLabelValues(message.Type).Inc()
+	if reclaimed, err := strconv.ParseFloat(message.Actor.Attributes["reclaimed"], 64); err == nil {
+		t.reclaimedBytes.WithLabelValues(message.Type).Add(reclaimed)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const overflowLabelValue = "overflow"
+
+// cardinalityGuard limits the number of unique values of each
+// template-derived label, replacing values past the limit with "overflow".
+type cardinalityGuard struct {
+	maxValues int
+
+	mu        sync.Mutex
+	values    map[string]map[string]struct{}
+	overflows map[string]uint64
+}
+
+func newCardinalityGuard(maxValues int) *cardinalityGuard {
+	return &cardinalityGuard{
+		maxValues: maxValues,
+		values:    make(map[string]map[string]struct{}),
+		overflows: make(map[string]uint64),
+	}
+}
+
+// value returns the value to export for label, which is either value itself
+// or "overflow" once the label exceeded its maximum number of unique values.
+func (g *cardinalityGuard) value(label, value string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	values, ok := g.values[label]
+	if !ok {
+		values = make(map[string]struct{})
+		g.values[label] = values
+	}
+	if _, seen := values[value]; seen {
+		return value
+	}
+	if len(values) < g.maxValues {
+		values[value] = struct{}{}
+		return value
+	}
+	g.overflows[label]++
+	return overflowLabelValue
+}
+
+func (g *cardinalityGuard) collect(ch chan<- prometheus.Metric) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for label, overflows := range g.overflows {
+		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+			"docker_exporter_label_overflows_total", "",
+			[]string{"label"}, nil),
+			prometheus.CounterValue,
+			float64(overflows),
+			label)
+	}
+}
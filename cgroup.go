@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	cgroupDriverSystemd  = "systemd"
+	cgroupDriverCgroupfs = "cgroupfs"
+)
+
+// cgroups resolves the cgroups of containers according to the cgroup driver
+// and version of the daemon, detected on first use, under the cgroup
+// filesystem mounted at root.
+//
+// When the daemon or the exporter run in a private cgroup namespace, as with
+// Docker in Docker or sysbox, the cgroup paths of the daemon are relative to
+// its namespace rather than the cgroup filesystem. Directories are then
+// resolved from the /proc/<pid>/cgroup of the main process of containers,
+// which is relative to the cgroup namespace of the exporter.
+type cgroups struct {
+	docker   *client.Client
+	root     string
+	procPath string
+
+	mu       sync.Mutex
+	detected bool
+	driver   string
+	version  string
+}
+
+func newCgroups(docker *client.Client, root, procPath string) *cgroups {
+	return &cgroups{docker: docker, root: root, procPath: procPath}
+}
+
+// detect returns the cgroup driver and version of the daemon.
+func (c *cgroups) detect(ctx context.Context) (driver, version string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.detected {
+		info, err := c.docker.Info(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		c.driver, c.version, c.detected = info.CgroupDriver, info.CgroupVersion, true
+	}
+	return c.driver, c.version, nil
+}
+
+// collect exports the cgroup version and driver of the daemon, unless it has
+// no cgroups such as on Windows.
+func (c *cgroups) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	driver, version, err := c.detect(ctx)
+	if err != nil || version == "" {
+		return
+	}
+	value, err := strconv.ParseFloat(version, 64)
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+		"docker_engine_cgroup_version", "",
+		nil, nil),
+		prometheus.GaugeValue,
+		value)
+	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+		"docker_engine_cgroup_driver_info", "",
+		[]string{"driver"}, nil),
+		prometheus.GaugeValue,
+		1,
+		driver)
+}
+
+// path returns the path of the cgroup of a container relative to the cgroup
+// hierarchy.
+func (c *cgroups) path(ctx context.Context, containerJson types.ContainerJSON) (string, error) {
+	driver, _, err := c.detect(ctx)
+	if err != nil {
+		return "", err
+	}
+	parent := ""
+	if containerJson.HostConfig != nil {
+		parent = containerJson.HostConfig.CgroupParent
+	}
+	if driver == cgroupDriverSystemd {
+		if parent == "" {
+			parent = "system.slice"
+		}
+		return path.Join(expandSlice(parent), "docker-"+containerJson.ID+".scope"), nil
+	}
+	if parent == "" {
+		parent = "/docker"
+	}
+	return path.Join("/", parent, containerJson.ID), nil
+}
+
+// dir returns the directory of the cgroup of a container on the cgroup
+// filesystem, for the given controller on cgroup v1 hosts.
+func (c *cgroups) dir(ctx context.Context, containerJson types.ContainerJSON, controller string) (string, error) {
+	cgroupPath, err := c.path(ctx, containerJson)
+	if err != nil {
+		return "", err
+	}
+	_, version, _ := c.detect(ctx)
+	if version != "1" {
+		controller = ""
+	}
+
+	dir := filepath.Join(c.root, controller, cgroupPath)
+	if _, err := os.Stat(dir); err == nil || !errors.Is(err, os.ErrNotExist) {
+		return dir, nil
+	}
+	if containerJson.State != nil && containerJson.State.Pid > 0 {
+		procCgroupPath, err := readProcCgroup(
+			filepath.Join(c.procPath, strconv.Itoa(containerJson.State.Pid), "cgroup"), controller)
+		if err == nil {
+			if procCgroupPath == "/.." || strings.HasPrefix(procCgroupPath, "/../") {
+				return "", fmt.Errorf(
+					"cgroup %s is outside the cgroup namespace of the exporter, run it with --cgroupns=host", cgroupPath)
+			}
+			dir = filepath.Join(c.root, controller, procCgroupPath)
+			if _, err := os.Stat(dir); err == nil {
+				return dir, nil
+			}
+		}
+	}
+	return "", fmt.Errorf(
+		"cgroup %s not found under %s, mount the host cgroup filesystem at HOST_CGROUP and the host /proc at HOST_PROC with pid: host",
+		cgroupPath, c.root)
+}
+
+// readProcCgroup returns the path of the cgroup of a process for the given
+// controller, or in the unified hierarchy if the controller is empty, from
+// its /proc/<pid>/cgroup file.
+func readProcCgroup(name, controller string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if controller == "" && fields[0] == "0" && fields[1] == "" {
+			return fields[2], nil
+		}
+		for _, c := range strings.Split(fields[1], ",") {
+			if controller != "" && c == controller {
+				return fields[2], nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no cgroup for controller %q in %s", controller, name)
+}
+
+// expandSlice expands a systemd slice into its path in the cgroup hierarchy,
+// such as "/a.slice/a-b.slice" for "a-b.slice".
+func expandSlice(slice string) string {
+	name := strings.TrimSuffix(slice, ".slice")
+	if name == slice || name == "" || name == "-" || strings.Contains(name, "/") {
+		return path.Join("/", slice)
+	}
+	result := ""
+	prefix := ""
+	for _, component := range strings.Split(name, "-") {
+		prefix += component
+		result += "/" + prefix + ".slice"
+		prefix += "-"
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// checkCommand verifies that the exporter can collect metrics from the
+// Docker daemon with the current configuration.
+func checkCommand(e *exporter, args []string) int {
+	failed := false
+	ok := func(format string, a ...any) {
+		fmt.Printf("ok: "+format+"\n", a...)
+	}
+	fail := func(format string, a ...any) {
+		fmt.Printf("error: "+format+"\n", a...)
+		failed = true
+	}
+	ctx := context.Background()
+
+	if _, err := e.docker.Ping(ctx); err != nil {
+		fail("cannot connect to the Docker daemon at %s: %v\n"+
+			"  check that the socket is mounted and readable by the user of the exporter, or that DOCKER_HOST is correct", e.docker.DaemonHost(), err)
+		return 1
+	}
+	ok("connected to the Docker daemon at %s", e.docker.DaemonHost())
+
+	version, err := e.docker.ServerVersion(ctx)
+	if err != nil {
+		fail("cannot get the Docker daemon version: %v", err)
+	} else {
+		ok("Docker %s, API version %s (negotiated %s)", version.Version, version.APIVersion, e.transport.versions.current())
+	}
+
+	info, err := e.docker.Info(ctx)
+	if err != nil {
+		fail("cannot get the Docker daemon info: %v", err)
+	} else {
+		ok("cgroup version %s, driver %s", info.CgroupVersion, info.CgroupDriver)
+	}
+
+	containers, err := e.docker.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(filters.Arg("status", "running")),
+		Limit:   1,
+	})
+	if err != nil {
+		fail("cannot list containers: %v", err)
+		return 1
+	}
+	if len(containers) == 0 {
+		fail("no running container to check stats and label templates with")
+		return 1
+	}
+	container := containers[0]
+	name := containerName(&container)
+
+	containerJson, err := e.docker.ContainerInspect(ctx, container.ID)
+	if err != nil {
+		fail("cannot inspect container %s: %v", name, err)
+		return 1
+	}
+
+	statsReader, err := e.docker.ContainerStatsOneShot(ctx, container.ID)
+	if err != nil {
+		fail("cannot get stats of container %s: %v", name, err)
+	} else {
+		var stats types.StatsJSON
+		err = json.NewDecoder(statsReader.Body).Decode(&stats)
+		statsReader.Body.Close()
+		switch {
+		case err != nil:
+			fail("cannot decode stats of container %s: %v", name, err)
+		case stats.MemoryStats.Usage == 0 && stats.CPUStats.CPUUsage.TotalUsage == 0:
+			fail("stats of container %s are empty\n"+
+				"  check that the memory and cpu cgroup controllers are enabled on the host", name)
+		default:
+			ok("stats available for container %s", name)
+		}
+	}
+
+	for _, label := range e.extraLabels {
+		value, err := e.labelLimits.execute(label, &container, containerJson)
+		if err != nil {
+			fail("template for label %s failed on container %s: %v", label.name, name, err)
+		} else {
+			ok("label %s=%q for container %s", label.name, value, name)
+		}
+	}
+
+	if failed {
+		fmt.Fprintln(os.Stderr, "check failed")
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+const commandMaxLength = 64
+
+// commandHash returns a short SHA-256 hash of the entrypoint and command of
+// a container, distinguishing the boundaries of their arguments.
+func commandHash(config *container.Config) string {
+	hash := sha256.New()
+	for _, arg := range config.Entrypoint {
+		hash.Write([]byte(arg))
+		hash.Write([]byte{0})
+	}
+	// separate the entrypoint from the command
+	hash.Write([]byte{0})
+	for _, arg := range config.Cmd {
+		hash.Write([]byte(arg))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:4])
+}
+
+// commandText returns the entrypoint and command of a container separated by
+// spaces, truncated to 64 characters.
+func commandText(config *container.Config) string {
+	args := make([]string, 0, len(config.Entrypoint)+len(config.Cmd))
+	args = append(args, config.Entrypoint...)
+	args = append(args, config.Cmd...)
+	text := strings.Join(args, " ")
+	if runes := []rune(text); len(runes) > commandMaxLength {
+		text = string(runes[:commandMaxLength])
+	}
+	return text
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// commands are the subcommands available in addition to the default of
+// serving metrics, returning the exit code of the process.
+var commands = map[string]func(e *exporter, args []string) int{
+	"bench":               benchCommand,
+	"check":               checkCommand,
+	"list":                listCommand,
+	"print-scrape-config": printScrapeConfigCommand,
+	"record":              recordCommand,
+	"render-label":        renderLabelCommand,
+}
+
+func runCommand(e *exporter, name string, args []string) int {
+	command, ok := commands[name]
+	if !ok {
+		names := []string{}
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "unknown command %q, available commands: %s\n", name, strings.Join(names, ", "))
+		return 2
+	}
+	return command(e, args)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	composeOneoffLabel  = "com.docker.compose.oneoff"
+)
+
+// collectComposeHealth exports whether all containers of each Compose
+// project are running and, for those with a health check, healthy. One-off
+// containers created by "docker compose run" are ignored.
+func collectComposeHealth(containers []types.Container, ch chan<- prometheus.Metric) {
+	healthy := make(map[string]bool)
+	for _, container := range containers {
+		project := container.Labels[composeProjectLabel]
+		if project == "" || container.Labels[composeOneoffLabel] == "True" {
+			continue
+		}
+		if _, ok := healthy[project]; !ok {
+			healthy[project] = true
+		}
+		// the status of containers with a health check ends with
+		// "(healthy)", "(unhealthy)" or "(health: starting)"
+		isHealthy := container.State == "running" &&
+			!strings.HasSuffix(container.Status, "(unhealthy)") &&
+			!strings.HasSuffix(container.Status, "(health: starting)")
+		healthy[project] = healthy[project] && isHealthy
+	}
+
+	for project, isHealthy := range healthy {
+		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+			"docker_compose_project_healthy", "",
+			[]string{"project"}, nil),
+			prometheus.GaugeValue,
+			boolToFloat(isHealthy),
+			project)
+	}
+}
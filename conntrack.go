@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectConntrack exports the number of conntrack entries in the network
+// namespace of a container, read through the /proc of the host mounted at
+// procPath.
+func collectConntrack(m *containerMetrics, procPath string, pid int) error {
+	entries, err := conntrackEntries(filepath.Join(procPath, strconv.Itoa(pid), "net", "stat", "nf_conntrack"))
+	if err != nil {
+		return &collectError{reasonOther, fmt.Errorf("cannot read conntrack entries: %v", err)}
+	}
+	m.send("docker_container_conntrack_entries", prometheus.GaugeValue, float64(entries))
+	return nil
+}
+
+// conntrackEntries parses the entries column of a nf_conntrack stat file,
+// which has the same hexadecimal count of the network namespace on the line
+// of each CPU.
+func conntrackEntries(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "entries") {
+		return 0, fmt.Errorf("unexpected nf_conntrack header in %s", path)
+	}
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("no nf_conntrack stats in %s", path)
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("no nf_conntrack stats in %s", path)
+	}
+	return strconv.ParseUint(fields[0], 16, 64)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectCPUMax exports the CPU limit of a container in number of CPUs, read
+// from the CPU quota and period of its cgroup, so that limits changed at
+// runtime are exported as enforced by the kernel. Nothing is exported for
+// containers without a CPU quota.
+func (e *exporter) collectCPUMax(ctx context.Context, m *containerMetrics, containerJson types.ContainerJSON) error {
+	_, version, err := e.cgroups.detect(ctx)
+	if err != nil {
+		return &collectError{reasonOther, fmt.Errorf("cannot detect cgroup version: %v", err)}
+	}
+	dir, err := e.cgroups.dir(ctx, containerJson, "cpu")
+	if err != nil {
+		return &collectError{reasonOther, fmt.Errorf("cannot read CPU quota: %v", err)}
+	}
+	var quota, period int64
+	if version == "1" {
+		quota, err = readSysfsInt(filepath.Join(dir, "cpu.cfs_quota_us"))
+		if err == nil {
+			period, err = readSysfsInt(filepath.Join(dir, "cpu.cfs_period_us"))
+		}
+	} else {
+		quota, period, err = readCPUMax(filepath.Join(dir, "cpu.max"))
+	}
+	if err != nil {
+		return &collectError{reasonOther, fmt.Errorf("cannot read CPU quota: %v", err)}
+	}
+	if quota <= 0 || period <= 0 {
+		return nil
+	}
+	m.send("docker_container_cpu_limit_cpus", prometheus.GaugeValue, float64(quota)/float64(period))
+	return nil
+}
+
+// readCPUMax parses the quota and period of a cpu.max file of cgroup v2,
+// with a quota of -1 for "max".
+func readCPUMax(path string) (quota, period int64, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("invalid cpu.max %q", strings.TrimSpace(string(data)))
+	}
+	period, err = strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cpu.max period %q", fields[1])
+	}
+	if fields[0] == "max" {
+		return -1, period, nil
+	}
+	quota, err = strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cpu.max quota %q", fields[0])
+	}
+	return quota, period, nil
+}
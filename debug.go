@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// newDebugStatsHandler serves the raw inspect and stats payloads returned by
+// the Docker daemon for a container at /debug/container/{name}/stats.
+func newDebugStatsHandler(e *exporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := strings.CutPrefix(r.URL.Path, "/debug/container/")
+		name, found := strings.CutSuffix(name, "/stats")
+		if !ok || !found || name == "" || strings.Contains(name, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, inspect, err := e.docker.ContainerInspectWithRaw(r.Context(), name, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		statsReader, err := e.docker.ContainerStatsOneShot(r.Context(), name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer statsReader.Body.Close()
+		stats, err := io.ReadAll(statsReader.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Inspect json.RawMessage `json:"inspect"`
+			Stats   json.RawMessage `json:"stats"`
+		}{inspect, stats})
+	})
+}
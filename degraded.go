@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statsChecks are the checks of the stats of running Linux containers for
+// fields unavailable on the platform, kernel, or cgroup configuration of the
+// host, which would be exported as zeros, by collector.
+var statsChecks = []struct {
+	collector   string
+	description string
+	missing     func(containerJson types.ContainerJSON, stats *types.StatsJSON) bool
+}{
+	{"cpu", "no CPU usage", func(_ types.ContainerJSON, stats *types.StatsJSON) bool {
+		return stats.CPUStats.CPUUsage.TotalUsage == 0
+	}},
+	{"cpu_percent", "no system CPU usage or number of CPUs", func(_ types.ContainerJSON, stats *types.StatsJSON) bool {
+		return stats.CPUStats.SystemUsage == 0 ||
+			stats.CPUStats.OnlineCPUs == 0 && len(stats.CPUStats.CPUUsage.PercpuUsage) == 0
+	}},
+	{"memory", "no memory usage, check that the memory cgroup controller is enabled", func(_ types.ContainerJSON, stats *types.StatsJSON) bool {
+		return stats.MemoryStats.Usage == 0
+	}},
+	{"memory_breakdown", "no memory stats", func(_ types.ContainerJSON, stats *types.StatsJSON) bool {
+		return len(stats.MemoryStats.Stats) == 0
+	}},
+	{"pids", "no number of processes, check that the pids cgroup controller is enabled", func(_ types.ContainerJSON, stats *types.StatsJSON) bool {
+		return stats.PidsStats.Current == 0
+	}},
+	{"network", "no network stats", func(containerJson types.ContainerJSON, stats *types.StatsJSON) bool {
+		// containers sharing the network of the host or another container,
+		// or without network, have no network stats of their own
+		if containerJson.HostConfig != nil {
+			networkMode := containerJson.HostConfig.NetworkMode
+			if networkMode.IsHost() || networkMode.IsContainer() || networkMode.IsNone() {
+				return false
+			}
+		}
+		return len(stats.Networks) == 0
+	}},
+}
+
+// degradations keeps track of the collectors whose stats are unavailable for
+// running containers, so that their zeros are not trusted. Each degraded
+// collector is logged once.
+type degradations struct {
+	mu     sync.Mutex
+	byID   map[string][]string
+	logged map[string]bool
+}
+
+func newDegradations() *degradations {
+	return &degradations{
+		byID:   make(map[string][]string),
+		logged: make(map[string]bool),
+	}
+}
+
+// observe runs the stats checks on the stats of a running container.
+func (d *degradations) observe(container *types.Container, containerJson types.ContainerJSON, stats *types.StatsJSON) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var degraded []string
+	for _, check := range statsChecks {
+		if !check.missing(containerJson, stats) {
+			continue
+		}
+		degraded = append(degraded, check.collector)
+		if !d.logged[check.collector] {
+			log.Printf("collector %s degraded for container %s: %s", check.collector, containerName(container), check.description)
+			d.logged[check.collector] = true
+		}
+	}
+	d.byID[container.ID] = degraded
+}
+
+// retain removes the checks of containers not in containers.
+func (d *degradations) retain(containers []types.Container) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	listed := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		if container.State == "running" {
+			listed[container.ID] = true
+		}
+	}
+	for id := range d.byID {
+		if !listed[id] {
+			delete(d.byID, id)
+		}
+	}
+}
+
+func (d *degradations) collect(ch chan<- prometheus.Metric) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.byID) == 0 {
+		return
+	}
+	degraded := make(map[string]bool)
+	for _, collectors := range d.byID {
+		for _, collector := range collectors {
+			degraded[collector] = true
+		}
+	}
+	for _, check := range statsChecks {
+		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+			"docker_exporter_collector_degraded", "",
+			[]string{"collector"}, nil),
+			prometheus.GaugeValue,
+			boolToFloat(degraded[check.collector]),
+			check.collector)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const composeDependsOnLabel = "com.docker.compose.depends_on"
+
+// collectDependencies exports the legacy links of a container, and the
+// services it depends on from the depends_on label of Docker Compose, made
+// of "service:condition" or "service:condition:restart" items separated by
+// commas.
+func collectDependencies(m *containerMetrics, containerJson types.ContainerJSON) {
+	if containerJson.HostConfig != nil {
+		for _, link := range containerJson.HostConfig.Links {
+			// links are "/target:/name/alias"
+			target, alias, _ := strings.Cut(link, ":")
+			m.sendWithLabels("docker_container_link_info", prometheus.GaugeValue, 1,
+				[]string{"target", "alias"},
+				strings.TrimPrefix(target, "/"), alias[strings.LastIndex(alias, "/")+1:])
+		}
+	}
+
+	if containerJson.Config == nil || containerJson.Config.Labels[composeDependsOnLabel] == "" {
+		return
+	}
+	for _, dependency := range strings.Split(containerJson.Config.Labels[composeDependsOnLabel], ",") {
+		service, condition, _ := strings.Cut(dependency, ":")
+		condition, _, _ = strings.Cut(condition, ":")
+		if service == "" {
+			continue
+		}
+		m.sendWithLabels("docker_container_depends_on_info", prometheus.GaugeValue, 1,
+			[]string{"depends_on", "condition"},
+			service, condition)
+	}
+}
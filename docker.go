@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+const dockerMaxIdleConns = 64
+
+// dockerClientConfig configures the connections to the Docker daemon, with
+// zero values keeping the defaults of the Docker client.
+type dockerClientConfig struct {
+	dialTimeout     time.Duration
+	keepAlive       time.Duration
+	idleConnTimeout time.Duration
+	maxIdleConns    int
+	// fallbackHosts are the Docker hosts to fail over to when the Docker
+	// host of the environment is unavailable
+	fallbackHosts []string
+}
+
+// dockerTransport instruments the requests made to the Docker API, and
+// observes the API version of the daemon if versions is set, sending the
+// requests with the version negotiated again after the daemon changed.
+type dockerTransport struct {
+	http.RoundTripper
+	requests atomic.Uint64
+	versions *apiVersions
+	// failover is the transport of the Docker endpoints, if fallback hosts
+	// are configured
+	failover *failoverTransport
+}
+
+func (t *dockerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	if t.versions != nil {
+		req = t.versions.rewrite(req)
+	}
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err == nil && t.versions != nil {
+		t.versions.observe(resp.Header)
+	}
+	return resp, err
+}
+
+// newDockerClient creates a Docker client configured from the environment
+// and config, with its HTTP transport wrapped by a dockerTransport.
+func newDockerClient(config dockerClientConfig) (*client.Client, *dockerTransport, error) {
+	// the transport is only configured for the Docker host by FromEnv, and
+	// cannot be wrapped before
+	docker, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpClient := docker.HTTPClient()
+	if transport, ok := httpClient.Transport.(*http.Transport); ok {
+		if err := configureTransport(transport, docker.DaemonHost(), config); err != nil {
+			return nil, nil, err
+		}
+	}
+	transport := &dockerTransport{RoundTripper: httpClient.Transport}
+	if len(config.fallbackHosts) > 0 {
+		transport.failover, err = newDockerFailover(docker.DaemonHost(), httpClient.Transport, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		transport.RoundTripper = transport.failover
+	}
+	httpClient.Transport = transport
+
+	docker, err = client.NewClientWithOpts(
+		client.FromEnv,
+		client.WithAPIVersionNegotiation(),
+		client.WithHTTPClient(httpClient),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	transport.versions = newAPIVersions(docker, os.Getenv(client.EnvOverrideAPIVersion) != "")
+	return docker, transport, nil
+}
+
+// configureTransport configures the transport to a Docker host with config.
+func configureTransport(transport *http.Transport, host string, config dockerClientConfig) error {
+	// containers are collected concurrently, keep their connections open
+	// across scrapes instead of dialing new ones
+	maxIdleConns := dockerMaxIdleConns
+	if config.maxIdleConns > 0 {
+		maxIdleConns = config.maxIdleConns
+	}
+	transport.MaxIdleConnsPerHost = maxIdleConns
+	transport.MaxIdleConns = maxIdleConns
+	if config.idleConnTimeout > 0 {
+		transport.IdleConnTimeout = config.idleConnTimeout
+	}
+	if config.dialTimeout > 0 || config.keepAlive > 0 {
+		return configureDialer(transport, host, config)
+	}
+	return nil
+}
+
+// newDockerFailover creates the failover transport of the primary Docker
+// host, with the transport of the Docker client, and the fallback hosts of
+// config, with transports configured like the one of the Docker client.
+func newDockerFailover(host string, primary http.RoundTripper, config dockerClientConfig) (*failoverTransport, error) {
+	transport, ok := primary.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("cannot fail over from transport %T", primary)
+	}
+	endpoint, err := newFailoverEndpoint(host, transport)
+	if err != nil {
+		return nil, err
+	}
+	failover := &failoverTransport{endpoints: []*failoverEndpoint{endpoint}}
+	for _, fallbackHost := range config.fallbackHosts {
+		fallback, err := client.NewClientWithOpts(client.FromEnv, client.WithHost(fallbackHost))
+		if err != nil {
+			return nil, fmt.Errorf("invalid fallback host %s: %v", fallbackHost, err)
+		}
+		transport, ok := fallback.HTTPClient().Transport.(*http.Transport)
+		if !ok {
+			return nil, fmt.Errorf("cannot fail over to transport %T", fallback.HTTPClient().Transport)
+		}
+		if err := configureTransport(transport, fallbackHost, config); err != nil {
+			return nil, err
+		}
+		endpoint, err := newFailoverEndpoint(fallbackHost, transport)
+		if err != nil {
+			return nil, err
+		}
+		failover.endpoints = append(failover.endpoints, endpoint)
+	}
+	return failover, nil
+}
+
+// configureDialer replaces the dialer of the transport to a Docker host with
+// one using the dial timeout and keep-alive period of config.
+func configureDialer(transport *http.Transport, host string, config dockerClientConfig) error {
+	hostURL, err := client.ParseHostURL(host)
+	if err != nil {
+		return err
+	}
+	dialer := &net.Dialer{Timeout: config.dialTimeout, KeepAlive: config.keepAlive}
+	switch hostURL.Scheme {
+	case "unix":
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", hostURL.Host)
+		}
+	case "tcp":
+		transport.DialContext = dialer.DialContext
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdEncoders are reused across responses, as zstd encoders allocate large
+// buffers.
+var zstdEncoders = sync.Pool{
+	New: func() any {
+		encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return encoder
+	},
+}
+
+// serveEncoded serves a metrics response compressed with zstd when the
+// client prefers it to gzip in its Accept-Encoding header, leaving other
+// encodings to the handler.
+func serveEncoded(handler http.Handler, w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if !prefersZstd(r.Header.Get("Accept-Encoding")) {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	encoder := zstdEncoders.Get().(*zstd.Encoder)
+	defer zstdEncoders.Put(encoder)
+	encoder.Reset(w)
+
+	r = r.Clone(r.Context())
+	r.Header.Del("Accept-Encoding")
+	w.Header().Set("Content-Encoding", "zstd")
+	handler.ServeHTTP(&encodedResponseWriter{w, encoder}, r)
+	encoder.Close()
+}
+
+// prefersZstd reports whether an Accept-Encoding header accepts zstd with a
+// quality at least as high as gzip.
+func prefersZstd(acceptEncoding string) bool {
+	qualities := make(map[string]float64)
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if quality, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		qualities[strings.ToLower(coding)] = quality
+	}
+	zstdQuality, ok := qualities["zstd"]
+	return ok && zstdQuality > 0 && zstdQuality >= qualities["gzip"]
+}
+
+// encodedResponseWriter writes the body of a response through an encoder.
+type encodedResponseWriter struct {
+	http.ResponseWriter
+	encoder *zstd.Encoder
+}
+
+func (w *encodedResponseWriter) Write(p []byte) (int, error) {
+	return w.encoder.Write(p)
+}
+
+func (w *encodedResponseWriter) WriteHeader(statusCode int) {
+	// the length of the encoded body is not known in advance
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(statusCode)
+}
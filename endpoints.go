@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// endpointStatus is the result of the last request listing the containers of
+// a Docker endpoint.
+type endpointStatus struct {
+	up            bool
+	lastReason    string
+	lastErrorTime time.Time
+}
+
+// endpointList keeps track of the status of the Docker endpoints, so that an
+// unreachable endpoint is visible from the metrics.
+type endpointList struct {
+	mu     sync.Mutex
+	byHost map[string]*endpointStatus
+}
+
+func newEndpointList() *endpointList {
+	return &endpointList{byHost: make(map[string]*endpointStatus)}
+}
+
+// record records the result of listing the containers of an endpoint.
+func (l *endpointList) record(host string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status, ok := l.byHost[host]
+	if !ok {
+		status = &endpointStatus{}
+		l.byHost[host] = status
+	}
+	status.up = err == nil
+	if err != nil {
+		status.lastReason = endpointErrorReason(err)
+		status.lastErrorTime = time.Now()
+	}
+}
+
+// Reasons of errors of requests to endpoints, next to reasonTimeout and
+// reasonOther.
+const (
+	reasonRefused    = "refused"
+	reasonTLS        = "tls"
+	reasonPermission = "permission"
+)
+
+// endpointErrorReason returns the reason of an error of a request to an
+// endpoint, out of a bounded set so as not to export the text of errors as
+// labels.
+func endpointErrorReason(err error) string {
+	var netErr net.Error
+	var recordHeaderErr tls.RecordHeaderError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var certificateInvalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return reasonTimeout
+	case errors.As(err, &recordHeaderErr), errors.As(err, &unknownAuthorityErr),
+		errors.As(err, &certificateInvalidErr), errors.As(err, &hostnameErr),
+		strings.Contains(err.Error(), "tls: "):
+		return reasonTLS
+	case errors.Is(err, os.ErrPermission):
+		return reasonPermission
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ENOENT), client.IsErrConnectionFailed(err):
+		return reasonRefused
+	default:
+		return reasonOther
+	}
+}
+
+func (l *endpointList) collect(ch chan<- prometheus.Metric) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	hosts := make([]string, 0, len(l.byHost))
+	for host := range l.byHost {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		status := l.byHost[host]
+		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+			"docker_exporter_endpoint_up", "",
+			[]string{"host"}, nil),
+			prometheus.GaugeValue,
+			boolToFloat(status.up),
+			host)
+		if status.lastReason != "" {
+			ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+				"docker_exporter_endpoint_last_error_info", "",
+				[]string{"host", "reason"}, nil),
+				prometheus.GaugeValue,
+				1,
+				host, status.lastReason)
+			ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+				"docker_exporter_endpoint_last_error_timestamp_seconds", "",
+				[]string{"host"}, nil),
+				prometheus.GaugeValue,
+				float64(status.lastErrorTime.UnixNano())/float64(time.Second),
+				host)
+		}
+	}
+}
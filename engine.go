@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const engineMetricsTimeout = 5 * time.Second
+
+// engineMetrics gathers the metrics exposed by the Docker daemon itself when
+// configured with metrics-addr, renamed under the docker_engine_ namespace.
+type engineMetrics struct {
+	url    string
+	client *http.Client
+}
+
+func newEngineMetrics(url string) *engineMetrics {
+	return &engineMetrics{
+		url:    url,
+		client: &http.Client{Timeout: engineMetricsTimeout},
+	}
+}
+
+// Gather never fails, to avoid failing the whole scrape when the daemon
+// metrics are unavailable.
+func (m *engineMetrics) Gather() ([]*dto.MetricFamily, error) {
+	families, err := m.fetch()
+	if err != nil {
+		log.Printf("cannot get engine metrics: %v", err)
+		return nil, nil
+	}
+
+	result := make([]*dto.MetricFamily, 0, len(families))
+	for name, family := range families {
+		renamed := "docker_engine_" + strings.TrimPrefix(name, "engine_")
+		family.Name = &renamed
+		result = append(result, family)
+	}
+	return result, nil
+}
+
+func (m *engineMetrics) fetch() (map[string]*dto.MetricFamily, error) {
+	resp, err := m.client.Get(m.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(resp.Body)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// envDefaults are the defaults of environmental variables of the profile
+// selected by PROFILE.
+var envDefaults map[string]string
+
+// getenv returns the value of an environmental variable or, when it is not
+// set, the content of the file named by the same variable with a _FILE
+// suffix, so that Docker and Swarm secrets can be used for credentials, or
+// else its default in the selected profile.
+func getenv(name string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return envDefaults[name]
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fatal(configError("cannot read %s_FILE: %v", name, err))
+	}
+	return strings.TrimRight(string(data), "\r\n")
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"strings"
+)
+
+// envHash returns a short hash of the values of the environment variables of
+// a container in names, which are sorted: an HMAC-SHA256 with key if set, so
+// that the values cannot be guessed from the hash without the key, else a
+// SHA-256 hash. Unset variables are distinguished from empty ones.
+func envHash(env []string, names []string, key []byte) string {
+	values := make(map[string]string, len(names))
+	for _, variable := range env {
+		name, value, _ := strings.Cut(variable, "=")
+		values[name] = value
+	}
+	var hash hash.Hash
+	if len(key) > 0 {
+		hash = hmac.New(sha256.New, key)
+	} else {
+		hash = sha256.New()
+	}
+	for _, name := range names {
+		hash.Write([]byte(name))
+		if value, ok := values[name]; ok {
+			hash.Write([]byte{'='})
+			hash.Write([]byte(value))
+		}
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+}
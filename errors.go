@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons of errors collecting a container.
+const (
+	reasonInspect = "inspect"
+	reasonStats   = "stats"
+	reasonDecode  = "decode"
+	reasonConfig  = "config"
+	reasonTimeout = "timeout"
+	reasonOther   = "other"
+)
+
+// collectError is an error collecting a container, classified by reason.
+type collectError struct {
+	reason string
+	err    error
+}
+
+func (e *collectError) Error() string {
+	return e.err.Error()
+}
+
+func (e *collectError) Unwrap() error {
+	return e.err
+}
+
+func errorReason(err error) string {
+	var collectErr *collectError
+	if errors.As(err, &collectErr) {
+		return collectErr.reason
+	}
+	return reasonOther
+}
+
+// errorSummary aggregates the errors of the containers of a collection
+// round.
+type errorSummary struct {
+	mu       sync.Mutex
+	byReason map[string][]string
+}
+
+func (s *errorSummary) add(containerName, reason string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.byReason == nil {
+		s.byReason = make(map[string][]string)
+	}
+	s.byReason[reason] = append(s.byReason[reason], fmt.Sprintf("%s: %v", containerName, err))
+}
+
+// String describes the errors by reason, with the first error of each in
+// the order of container names, since containers are collected concurrently.
+func (s *errorSummary) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reasons := []string{}
+	for reason := range s.byReason {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	parts := []string{}
+	for _, reason := range reasons {
+		errs := s.byReason[reason]
+		sort.Strings(errs)
+		parts = append(parts, fmt.Sprintf("%s: %d (%s)", reason, len(errs), errs[0]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s *errorSummary) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, errs := range s.byReason {
+		n += len(errs)
+	}
+	return n
+}
+
+// errorCounter counts the errors collecting containers across collection
+// rounds.
+type errorCounter struct {
+	mu       sync.Mutex
+	byReason map[string]uint64
+}
+
+func (c *errorCounter) add(s *errorSummary) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c.byReason == nil {
+		c.byReason = make(map[string]uint64)
+	}
+	for reason, errs := range s.byReason {
+		c.byReason[reason] += uint64(len(errs))
+	}
+}
+
+func (c *errorCounter) collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for reason, count := range c.byReason {
+		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+			"docker_exporter_container_errors_total", "",
+			[]string{"reason"}, nil),
+			prometheus.CounterValue,
+			float64(count),
+			reason)
+	}
+}
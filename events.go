@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+)
+
+const eventsRetryInterval = 5 * time.Second
+
+// eventHandler handles the events received from the Docker daemon.
+type eventHandler func(message events.Message)
+
+// eventWatcher subscribes to the events of the Docker daemon and dispatches
+// them to handlers, reconnecting when the connection is lost.
+type eventWatcher struct {
+	docker   *client.Client
+	handlers []eventHandler
+}
+
+// handle registers a handler of the events.
+func (w *eventWatcher) handle(handler eventHandler) {
+	w.handlers = append(w.handlers, handler)
+}
+
+func (w *eventWatcher) run() {
+	since := time.Now()
+	// the events at the time of the last event, which are received again
+	// after reconnecting since the start of events is inclusive
+	last := make(map[eventKey]bool)
+	for {
+		messages, errs := w.docker.Events(context.Background(), types.EventsOptions{
+			Since: since.Format(time.RFC3339Nano),
+		})
+	receive:
+		for {
+			select {
+			case message := <-messages:
+				key := eventKey{message.Type, message.Actor.ID, message.Action, message.TimeNano}
+				if message.TimeNano < since.UnixNano() || last[key] {
+					continue
+				}
+				if message.TimeNano != since.UnixNano() {
+					since = time.Unix(0, message.TimeNano)
+					last = make(map[eventKey]bool)
+				}
+				last[key] = true
+				for _, handler := range w.handlers {
+					handler(message)
+				}
+			case err := <-errs:
+				log.Printf("cannot receive events: %v", err)
+				break receive
+			}
+		}
+		time.Sleep(eventsRetryInterval)
+	}
+}
+
+// eventKey identifies an event of the Docker daemon.
+type eventKey struct {
+	typ      string
+	id       string
+	action   string
+	timeNano int64
+}
+
+// eventTime returns the time of an event.
+func eventTime(message events.Message) time.Time {
+	if message.TimeNano != 0 {
+		return time.Unix(0, message.TimeNano)
+	}
+	return time.Unix(message.Time, 0)
+}
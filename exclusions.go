@@ -0,0 +1,38 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// exclusionCounter counts the containers excluded from collection by reason
+// across collection rounds.
+type exclusionCounter struct {
+	mu       sync.Mutex
+	byReason map[string]uint64
+}
+
+func (c *exclusionCounter) add(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.byReason == nil {
+		c.byReason = make(map[string]uint64)
+	}
+	c.byReason[reason]++
+}
+
+func (c *exclusionCounter) collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for reason, count := range c.byReason {
+		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+			"docker_exporter_containers_excluded_total", "",
+			[]string{"reason"}, nil),
+			prometheus.CounterValue,
+			float64(count),
+			reason)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Exit codes of fatal errors, from sysexits.h, so that supervisors can tell
+// their causes apart. Other fatal errors exit with 1.
+const (
+	// exitConfig is the exit code of invalid configurations.
+	exitConfig = 78
+	// exitDocker is the exit code of failures to reach the Docker daemon.
+	exitDocker = 69
+	// exitListen is the exit code of failures to listen for or serve HTTP
+	// requests.
+	exitListen = 71
+)
+
+// fatalError is an error ending the process with an exit code.
+type fatalError struct {
+	code int
+	err  error
+}
+
+func (e *fatalError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fatalError) Unwrap() error {
+	return e.err
+}
+
+func configError(format string, args ...any) error {
+	return &fatalError{exitConfig, fmt.Errorf(format, args...)}
+}
+
+func dockerError(format string, args ...any) error {
+	return &fatalError{exitDocker, fmt.Errorf(format, args...)}
+}
+
+func listenError(format string, args ...any) error {
+	return &fatalError{exitListen, fmt.Errorf(format, args...)}
+}
+
+// fatal logs an error and exits with its exit code.
+func fatal(err error) {
+	log.Print(err)
+	var fatalErr *fatalError
+	if errors.As(err, &fatalErr) {
+		os.Exit(fatalErr.code)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// failbackInterval is the time after which the primary endpoint is probed
+// again after it failed, and failbackProbeTimeout the timeout of the probe.
+const (
+	failbackInterval     = 30 * time.Second
+	failbackProbeTimeout = 5 * time.Second
+)
+
+// failoverEndpoint is a Docker endpoint requests can be sent to.
+type failoverEndpoint struct {
+	host      string
+	transport http.RoundTripper
+	scheme    string
+	addr      string
+	basePath  string
+	local     bool
+	lastErr   error
+	tried     bool
+}
+
+// failoverTransport sends the requests of the Docker client to the first
+// available of a primary endpoint and fallback endpoints. While requests are
+// sent to a fallback endpoint, the primary endpoint is probed with a single
+// ping in the background failbackInterval after it last failed, and requests
+// are sent to it again once the ping succeeds. Requests are only retried on
+// another endpoint when they cannot be sent, not when the daemon responds
+// with an error.
+type failoverTransport struct {
+	mu            sync.Mutex
+	endpoints     []*failoverEndpoint
+	current       int
+	primaryFailed time.Time
+	probing       bool
+}
+
+func newFailoverEndpoint(host string, transport *http.Transport) (*failoverEndpoint, error) {
+	hostURL, err := client.ParseHostURL(host)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := &failoverEndpoint{
+		host:      host,
+		transport: transport,
+		scheme:    "http",
+		addr:      hostURL.Host,
+		basePath:  hostURL.Path,
+		local:     hostURL.Scheme == "unix" || hostURL.Scheme == "npipe",
+	}
+	if transport.TLSClientConfig != nil {
+		endpoint.scheme = "https"
+	}
+	return endpoint, nil
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	start := t.current
+	if start != 0 && !t.probing && time.Since(t.primaryFailed) >= failbackInterval {
+		t.probing = true
+		go t.probePrimary()
+	}
+	t.mu.Unlock()
+
+	// requests with a body that cannot be read again are not retried
+	retryable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	var resp *http.Response
+	var err error
+	for i := range t.endpoints {
+		index := (start + i) % len(t.endpoints)
+		endpoint := t.endpoints[index]
+		endpointReq := req
+		if index != 0 {
+			endpointReq, err = t.rewrite(req, endpoint)
+			if err != nil {
+				return nil, err
+			}
+		}
+		resp, err = endpoint.transport.RoundTrip(endpointReq)
+		t.record(index, err)
+		if err == nil || req.Context().Err() != nil || !retryable {
+			return resp, err
+		}
+	}
+	return resp, err
+}
+
+// probePrimary pings the primary endpoint, failing back to it if the ping
+// succeeds.
+func (t *failoverTransport) probePrimary() {
+	ctx, cancel := context.WithTimeout(context.Background(), failbackProbeTimeout)
+	defer cancel()
+	endpoint := t.endpoints[0]
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, "http://docker/_ping", nil)
+	if err == nil {
+		req.URL = &url.URL{Scheme: endpoint.scheme, Host: endpoint.addr, Path: endpoint.basePath + "/_ping"}
+		if endpoint.local {
+			req.Host = "docker"
+		}
+		var resp *http.Response
+		resp, err = endpoint.transport.RoundTrip(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+	t.record(0, err)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.probing = false
+}
+
+// rewrite returns a copy of a request of the Docker client to the primary
+// endpoint sent to another endpoint.
+func (t *failoverTransport) rewrite(req *http.Request, endpoint *failoverEndpoint) (*http.Request, error) {
+	endpointReq := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		endpointReq.Body = body
+	}
+	endpointReq.URL.Scheme = endpoint.scheme
+	endpointReq.URL.Host = endpoint.addr
+	endpointReq.URL.Path = endpoint.basePath + strings.TrimPrefix(req.URL.Path, t.endpoints[0].basePath)
+	endpointReq.URL.RawPath = ""
+	endpointReq.Host = ""
+	if endpoint.local {
+		endpointReq.Host = "docker"
+	}
+	return endpointReq, nil
+}
+
+// record records the result of a request to an endpoint, switching to the
+// endpoint if the request succeeded.
+func (t *failoverTransport) record(index int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	endpoint := t.endpoints[index]
+	if err != nil && (endpoint.lastErr == nil || endpoint.lastErr.Error() != err.Error()) {
+		log.Printf("Docker endpoint %s failed: %v", endpoint.host, err)
+	}
+	endpoint.tried = true
+	endpoint.lastErr = err
+	if err != nil && index == 0 {
+		t.primaryFailed = time.Now()
+	}
+	if err != nil || index == t.current {
+		return
+	}
+	if index == 0 {
+		log.Printf("Docker endpoint %s available again, failing back from %s", endpoint.host, t.endpoints[t.current].host)
+	} else {
+		log.Printf("Docker endpoint %s unavailable, failing over to %s", t.endpoints[t.current].host, endpoint.host)
+	}
+	t.current = index
+}
+
+// host returns the host of the endpoint requests are sent to.
+func (t *failoverTransport) host() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.endpoints[t.current].host
+}
+
+// recordEndpoints records in the endpoint list the status of the endpoints
+// tried by requests, other than the one in use.
+func (t *failoverTransport) recordEndpoints(endpoints *endpointList) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, endpoint := range t.endpoints {
+		if endpoint.tried && i != t.current {
+			endpoints.record(endpoint.host, endpoint.lastErr)
+		}
+	}
+}
+
+func (t *failoverTransport) collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, endpoint := range t.endpoints {
+		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+			"docker_exporter_endpoint_active", "",
+			[]string{"host"}, nil),
+			prometheus.GaugeValue,
+			boolToFloat(i == t.current),
+			endpoint.host)
+	}
+}
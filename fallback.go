@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fallbackTemplate returns the text of a label template evaluating to the
+// first non-empty value of an ordered, comma-separated chain of sources:
+// "label:<key>" for the value of a container label, or "name" for the name
+// of the container.
+func fallbackTemplate(chain string) (string, error) {
+	var text, end strings.Builder
+	for _, source := range strings.Split(chain, ",") {
+		source = strings.TrimSpace(source)
+		switch {
+		case source == "name":
+			// the name of a container is never empty, later sources are
+			// never reached
+			text.WriteString(`{{slice (index .Container.Names 0) 1}}`)
+			return text.String() + end.String(), nil
+		case strings.HasPrefix(source, "label:") && len(source) > len("label:"):
+			key := strings.TrimPrefix(source, "label:")
+			fmt.Fprintf(&text, `{{with index .Container.Labels %s}}{{.}}{{else}}`, strconv.Quote(key))
+			end.WriteString(`{{end}}`)
+		default:
+			return "", fmt.Errorf("invalid source %q: must be label:<key> or name", source)
+		}
+	}
+	return text.String() + end.String(), nil
+}
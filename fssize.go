@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// fsSizer gets the size of the filesystems of containers from the Docker
+// daemon, which computes them for all containers at once by listing them
+// with their sizes. As this is expensive for the daemon, the sizes are
+// refreshed in the background after a scrape, at most once per interval.
+type fsSizer struct {
+	docker   *client.Client
+	interval time.Duration
+
+	mu        sync.Mutex
+	sizes     map[string]fsSize
+	refreshed time.Time
+	running   bool
+}
+
+// fsSize is the size of the writable layer of a container, and the total
+// size of its root filesystem including its image.
+type fsSize struct {
+	rw     int64
+	rootFs int64
+}
+
+func newFSSizer(docker *client.Client, interval time.Duration) *fsSizer {
+	return &fsSizer{
+		docker:   docker,
+		interval: interval,
+		sizes:    make(map[string]fsSize),
+	}
+}
+
+// refresh starts listing the sizes of the containers when the last sizes are
+// older than the interval.
+func (s *fsSizer) refresh() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running || time.Since(s.refreshed) < s.interval {
+		return
+	}
+	s.running = true
+	go s.list()
+}
+
+func (s *fsSizer) list() {
+	containers, err := s.docker.ContainerList(context.Background(), types.ContainerListOptions{All: true, Size: true})
+	if err != nil {
+		log.Printf("cannot list container sizes: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+	s.refreshed = time.Now()
+	if err != nil {
+		return
+	}
+	s.sizes = make(map[string]fsSize, len(containers))
+	for _, container := range containers {
+		s.sizes[container.ID] = fsSize{container.SizeRw, container.SizeRootFs}
+	}
+}
+
+// size returns the last listed size of the filesystems of a container.
+func (s *fsSizer) size(containerID string) (fsSize, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, ok := s.sizes[containerID]
+	return size, ok
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-units"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// containerGroup is a named group of containers selected by their labels,
+// with optional CPU and memory budgets.
+type containerGroup struct {
+	name        string
+	selector    []string
+	cpus        float64
+	memoryBytes int64
+}
+
+// matches reports whether a container has all the labels of the selector
+// of the group, either "key=value" or "key" for any value.
+func (g *containerGroup) matches(container *types.Container) bool {
+	for _, term := range g.selector {
+		key, value, hasValue := strings.Cut(term, "=")
+		labelValue, ok := container.Labels[key]
+		if !ok || (hasValue && labelValue != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseGroups parses the groups defined by GROUP_<name> environment
+// variables, with their budgets in GROUP_CPUS_<name> and GROUP_MEMORY_<name>.
+func parseGroups(environ []string) ([]containerGroup, error) {
+	const prefix = "GROUP_"
+	selectors := make(map[string]string)
+	cpus := make(map[string]string)
+	memory := make(map[string]string)
+	for _, env := range environ {
+		name, value, _ := strings.Cut(env, "=")
+		name, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		if group, ok := strings.CutPrefix(name, "CPUS_"); ok {
+			cpus[group] = value
+		} else if group, ok := strings.CutPrefix(name, "MEMORY_"); ok {
+			memory[group] = value
+		} else {
+			selectors[name] = value
+		}
+	}
+	for group := range cpus {
+		if _, ok := selectors[group]; !ok {
+			return nil, fmt.Errorf("CPU budget of undefined group %s", group)
+		}
+	}
+	for group := range memory {
+		if _, ok := selectors[group]; !ok {
+			return nil, fmt.Errorf("memory budget of undefined group %s", group)
+		}
+	}
+
+	groups := []containerGroup{}
+	for name, selector := range selectors {
+		group := containerGroup{name: name}
+		for _, term := range strings.Split(selector, ",") {
+			if term = strings.TrimSpace(term); term != "" {
+				group.selector = append(group.selector, term)
+			}
+		}
+		if len(group.selector) == 0 {
+			return nil, fmt.Errorf("empty selector of group %s", name)
+		}
+		if value, ok := cpus[name]; ok {
+			var err error
+			group.cpus, err = strconv.ParseFloat(value, 64)
+			if err != nil || group.cpus <= 0 {
+				return nil, fmt.Errorf("invalid CPU budget %q of group %s: must be a positive number", value, name)
+			}
+		}
+		if value, ok := memory[name]; ok {
+			var err error
+			group.memoryBytes, err = units.RAMInBytes(value)
+			if err != nil || group.memoryBytes <= 0 {
+				return nil, fmt.Errorf("invalid memory budget %q of group %s: must be a positive size", value, name)
+			}
+		}
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	return groups, nil
+}
+
+// groupUsage accumulates the resource usage of the groups of containers in a
+// collection round. A nil groupUsage accumulates nothing.
+type groupUsage struct {
+	groups []containerGroup
+
+	mu          sync.Mutex
+	containers  []int
+	memoryBytes []float64
+	// cpuSeconds are the CPU time of the groups, accumulated by groupCPU
+	// from the CPU time of their members in containerCPU
+	cpuSeconds   []float64
+	containerCPU map[string]memberCPU
+}
+
+// memberCPU is the CPU time of a container and the groups it belongs to.
+type memberCPU struct {
+	groups     []int
+	cpuSeconds float64
+}
+
+func newGroupUsage(groups []containerGroup) *groupUsage {
+	if len(groups) == 0 {
+		return nil
+	}
+	return &groupUsage{
+		groups:       groups,
+		containers:   make([]int, len(groups)),
+		memoryBytes:  make([]float64, len(groups)),
+		cpuSeconds:   make([]float64, len(groups)),
+		containerCPU: make(map[string]memberCPU),
+	}
+}
+
+// add adds the usage of a container to the groups it belongs to.
+func (u *groupUsage) add(container *types.Container, cpuSeconds, memoryBytes float64) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	member := memberCPU{cpuSeconds: cpuSeconds}
+	for i := range u.groups {
+		if u.groups[i].matches(container) {
+			u.containers[i]++
+			u.memoryBytes[i] += memoryBytes
+			member.groups = append(member.groups, i)
+		}
+	}
+	if len(member.groups) > 0 {
+		u.containerCPU[container.ID] = member
+	}
+}
+
+// merge adds the usage accumulated by other, of the same groups.
+func (u *groupUsage) merge(other *groupUsage) {
+	if u == nil || other == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	other.mu.Lock()
+	defer other.mu.Unlock()
+
+	for i := range u.groups {
+		u.containers[i] += other.containers[i]
+		u.memoryBytes[i] += other.memoryBytes[i]
+	}
+	for id, member := range other.containerCPU {
+		u.containerCPU[id] = member
+	}
+}
+
+// groupCPU accumulates the CPU time of the groups of containers across
+// collection rounds from the increase of the CPU time of their members, so
+// that it does not decrease when containers leave groups or restart.
+type groupCPU struct {
+	mu         sync.Mutex
+	cpuSeconds []float64
+	last       map[string]float64
+}
+
+func newGroupCPU(groups []containerGroup) *groupCPU {
+	return &groupCPU{
+		cpuSeconds: make([]float64, len(groups)),
+		last:       make(map[string]float64),
+	}
+}
+
+// accumulate adds the increase of the CPU time of the members of the groups
+// since the last collection round to the CPU time of the groups, and sets
+// it in the usage. The whole CPU time of new and restarted members is added,
+// and the CPU time of members not collected in the round kept until they are
+// no longer in containers.
+func (c *groupCPU) accumulate(u *groupUsage, containers []types.Container) {
+	if u == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for id, member := range u.containerCPU {
+		increase := member.cpuSeconds
+		if last, ok := c.last[id]; ok && member.cpuSeconds >= last {
+			increase -= last
+		}
+		for _, i := range member.groups {
+			c.cpuSeconds[i] += increase
+		}
+		c.last[id] = member.cpuSeconds
+	}
+	listed := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		listed[container.ID] = true
+	}
+	for id := range c.last {
+		if !listed[id] {
+			delete(c.last, id)
+		}
+	}
+	copy(u.cpuSeconds, c.cpuSeconds)
+}
+
+func (u *groupUsage) collect(ch chan<- prometheus.Metric) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	send := func(name string, valueType prometheus.ValueType, value float64, group string) {
+		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(name, "", []string{"group"}, nil), valueType, value, group)
+	}
+	for i, group := range u.groups {
+		send("docker_group_containers", prometheus.GaugeValue, float64(u.containers[i]), group.name)
+		send("docker_group_cpu_seconds_total", prometheus.CounterValue, u.cpuSeconds[i], group.name)
+		send("docker_group_memory_usage_bytes", prometheus.GaugeValue, u.memoryBytes[i], group.name)
+		if group.cpus > 0 {
+			send("docker_group_cpu_budget_cpus", prometheus.GaugeValue, group.cpus, group.name)
+		}
+		if group.memoryBytes > 0 {
+			send("docker_group_memory_budget_bytes", prometheus.GaugeValue, float64(group.memoryBytes), group.name)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// defaultHistoryInterval is the default interval between the samples of the
+// history.
+const defaultHistoryInterval = 15 * time.Second
+
+// sparkBars are the characters of sparklines, from lowest to highest.
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// historySample is a sample of the usage of a container.
+type historySample struct {
+	Time        time.Time `json:"time"`
+	CPUPercent  float64   `json:"cpu_percent"`
+	MemoryBytes float64   `json:"memory_bytes"`
+	PIDs        float64   `json:"pids"`
+
+	cpuSeconds float64
+}
+
+// containerHistory is the ring buffer of the samples of a container.
+type containerHistory struct {
+	name    string
+	samples []historySample
+	next    int
+}
+
+// ordered returns the samples from oldest to newest.
+func (h *containerHistory) ordered() []historySample {
+	ordered := make([]historySample, 0, len(h.samples))
+	if len(h.samples) == cap(h.samples) {
+		ordered = append(ordered, h.samples[h.next:]...)
+	}
+	return append(ordered, h.samples[:h.next]...)
+}
+
+// historyList keeps the last samples of the usage of the running containers,
+// collected in the background independently of scrapes, for triage when
+// Prometheus is unreachable.
+type historyList struct {
+	docker   *client.Client
+	size     int
+	interval time.Duration
+	// excluded reports whether a container is excluded from collection
+	excluded func(*types.Container) bool
+
+	mu   sync.Mutex
+	byID map[string]*containerHistory
+}
+
+func newHistoryList(docker *client.Client, size int, interval time.Duration, excluded func(*types.Container) bool) *historyList {
+	return &historyList{
+		docker:   docker,
+		size:     size,
+		interval: interval,
+		excluded: excluded,
+		byID:     make(map[string]*containerHistory),
+	}
+}
+
+func (l *historyList) run() {
+	for {
+		l.sample()
+		time.Sleep(l.interval)
+	}
+}
+
+// sample samples the usage of the running containers.
+func (l *historyList) sample() {
+	ctx, cancel := context.WithTimeout(context.Background(), l.interval)
+	defer cancel()
+	containers, err := l.docker.ContainerList(
+		ctx,
+		types.ContainerListOptions{Filters: filters.NewArgs(filters.Arg("status", "running"))},
+	)
+	if err != nil {
+		log.Printf("cannot list containers for history: %v", err)
+		return
+	}
+	l.retain(containers)
+
+	for i := range containers {
+		container := &containers[i]
+		if l.excluded(container) {
+			continue
+		}
+		statsReader, err := l.docker.ContainerStatsOneShot(ctx, container.ID)
+		if err != nil {
+			continue
+		}
+		var stats types.StatsJSON
+		err = json.NewDecoder(statsReader.Body).Decode(&stats)
+		statsReader.Body.Close()
+		if err != nil {
+			continue
+		}
+		l.observe(container, &stats, memoryUsage(&stats))
+	}
+}
+
+func (l *historyList) observe(container *types.Container, stats *types.StatsJSON, memoryBytes uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h, ok := l.byID[container.ID]
+	if !ok {
+		h = &containerHistory{samples: make([]historySample, 0, l.size)}
+		l.byID[container.ID] = h
+	}
+	h.name = containerName(container)
+	sample := historySample{
+		Time:        stats.Read,
+		MemoryBytes: float64(memoryBytes),
+		PIDs:        float64(stats.PidsStats.Current),
+		cpuSeconds:  nsToS(stats.CPUStats.CPUUsage.TotalUsage),
+	}
+	if len(h.samples) > 0 {
+		last := h.samples[(h.next+len(h.samples)-1)%len(h.samples)]
+		if seconds := sample.Time.Sub(last.Time).Seconds(); seconds > 0 && sample.cpuSeconds >= last.cpuSeconds {
+			sample.CPUPercent = (sample.cpuSeconds - last.cpuSeconds) / seconds * 100
+		}
+	}
+	if len(h.samples) < cap(h.samples) {
+		h.samples = append(h.samples, sample)
+	} else {
+		h.samples[h.next] = sample
+	}
+	h.next = (h.next + 1) % cap(h.samples)
+}
+
+// retain removes the samples of containers not running in containers.
+func (l *historyList) retain(containers []types.Container) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	running := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		running[container.ID] = container.State == "running"
+	}
+	for id := range l.byID {
+		if !running[id] {
+			delete(l.byID, id)
+		}
+	}
+}
+
+// containerSamples are the samples of a container from oldest to newest.
+type containerSamples struct {
+	Name    string          `json:"name"`
+	Samples []historySample `json:"samples"`
+}
+
+func (l *historyList) list() []containerSamples {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	list := make([]containerSamples, 0, len(l.byID))
+	for _, h := range l.byID {
+		list = append(list, containerSamples{h.name, h.ordered()})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// sparkline draws values scaled between their minimum and maximum.
+func sparkline(values []float64) string {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, value := range values {
+		low, high = math.Min(low, value), math.Max(high, value)
+	}
+	var b strings.Builder
+	for _, value := range values {
+		i := 0
+		if high > low {
+			i = int((value - low) / (high - low) * float64(len(sparkBars)-1))
+		}
+		b.WriteRune(sparkBars[i])
+	}
+	return b.String()
+}
+
+var historyTemplate = template.Must(template.New("history").Funcs(template.FuncMap{
+	"spark": func(samples []historySample, field string) string {
+		values := make([]float64, len(samples))
+		for i, sample := range samples {
+			switch field {
+			case "cpu":
+				values[i] = sample.CPUPercent
+			case "memory":
+				values[i] = sample.MemoryBytes
+			case "pids":
+				values[i] = sample.PIDs
+			}
+		}
+		return sparkline(values)
+	},
+	"last": func(samples []historySample) historySample {
+		return samples[len(samples)-1]
+	},
+}).Parse(`<!DOCTYPE html>
+<meta charset="utf-8">
+<title>History</title>
+<table>
+<tr><th>Name</th><th>CPU %</th><th>Memory</th><th>PIDs</th></tr>
+{{range .}}<tr><td>{{.Name}}</td><td>{{spark .Samples "cpu"}} {{printf "%.1f" (last .Samples).CPUPercent}}</td><td>{{spark .Samples "memory"}} {{printf "%.0f" (last .Samples).MemoryBytes}}</td><td>{{spark .Samples "pids"}} {{(last .Samples).PIDs}}</td></tr>
+{{end}}</table>
+`))
+
+// newHistoryHandler serves the last samples of the running containers as
+// JSON, or as an HTML page of sparklines for browsers.
+func newHistoryHandler(l *historyList) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list := l.list()
+		if strings.Contains(r.Header.Get("Accept"), "text/html") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			historyTemplate.Execute(w, list)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	})
+}
@@ -0,0 +1,153 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// hostCollector collects basic metrics of the host itself, reading them from
+// the host /proc and root filesystem mounted at procPath and rootPath when
+// running in a container.
+type hostCollector struct {
+	procPath string
+	rootPath string
+}
+
+func newHostCollector(procPath, rootPath string) (*hostCollector, error) {
+	return &hostCollector{procPath, rootPath}, nil
+}
+
+// Describe describes no metrics, so that the host stats are not read when
+// the collector is registered.
+func (c *hostCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *hostCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := c.collectLoad(ch); err != nil {
+		log.Printf("cannot collect host load: %v", err)
+	}
+	if err := c.collectMemory(ch); err != nil {
+		log.Printf("cannot collect host memory: %v", err)
+	}
+	if err := c.collectFilesystem(ch); err != nil {
+		log.Printf("cannot collect host filesystem: %v", err)
+	}
+	if err := c.collectUptime(ch); err != nil {
+		log.Printf("cannot collect host uptime: %v", err)
+	}
+}
+
+func (c *hostCollector) collectLoad(ch chan<- prometheus.Metric) error {
+	data, err := os.ReadFile(filepath.Join(c.procPath, "loadavg"))
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return fmt.Errorf("unexpected loadavg format: %q", data)
+	}
+	for i, name := range []string{"docker_host_load1", "docker_host_load5", "docker_host_load15"} {
+		load, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+			name, "",
+			nil, nil),
+			prometheus.GaugeValue,
+			load)
+	}
+	return nil
+}
+
+func (c *hostCollector) collectMemory(ch chan<- prometheus.Metric) error {
+	file, err := os.Open(filepath.Join(c.procPath, "meminfo"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	meminfo := make(map[string]float64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) == 3 && fields[2] == "kB" {
+			value *= 1024
+		}
+		meminfo[strings.TrimSuffix(fields[0], ":")] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+		"docker_host_memory_total_bytes", "",
+		nil, nil),
+		prometheus.GaugeValue,
+		meminfo["MemTotal"])
+
+	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+		"docker_host_memory_available_bytes", "",
+		nil, nil),
+		prometheus.GaugeValue,
+		meminfo["MemAvailable"])
+	return nil
+}
+
+func (c *hostCollector) collectFilesystem(ch chan<- prometheus.Metric) error {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(c.rootPath, &stat); err != nil {
+		return err
+	}
+
+	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+		"docker_host_filesystem_size_bytes", "",
+		nil, nil),
+		prometheus.GaugeValue,
+		float64(stat.Blocks)*float64(stat.Bsize))
+
+	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+		"docker_host_filesystem_avail_bytes", "",
+		nil, nil),
+		prometheus.GaugeValue,
+		float64(stat.Bavail)*float64(stat.Bsize))
+	return nil
+}
+
+func (c *hostCollector) collectUptime(ch chan<- prometheus.Metric) error {
+	data, err := os.ReadFile(filepath.Join(c.procPath, "uptime"))
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 1 {
+		return fmt.Errorf("unexpected uptime format: %q", data)
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return err
+	}
+
+	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+		"docker_host_uptime_seconds", "",
+		nil, nil),
+		prometheus.GaugeValue,
+		uptime)
+	return nil
+}
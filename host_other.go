@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type hostCollector struct {
+	prometheus.Collector
+}
+
+func newHostCollector(procPath, rootPath string) (*hostCollector, error) {
+	return nil, errors.New("host metrics are only supported on Linux")
+}
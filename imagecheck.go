@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// defaultRegistryTimeout is the default timeout of each request of the image
+// check, including the registry queries made by the daemon.
+const defaultRegistryTimeout = 30 * time.Second
+
+// imageChecker periodically compares the image digest of running containers
+// against the latest digest of their image tag in the registry.
+type imageChecker struct {
+	docker   *client.Client
+	auths    map[string]types.AuthConfig
+	interval time.Duration
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	results map[string]bool
+}
+
+func newImageChecker(docker *client.Client, interval, timeout time.Duration, authConfig string) (*imageChecker, error) {
+	auths := make(map[string]types.AuthConfig)
+	if authConfig != "" {
+		var err error
+		auths, err = parseAuthConfig([]byte(authConfig))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &imageChecker{
+		docker:   docker,
+		auths:    auths,
+		interval: interval,
+		timeout:  timeout,
+		results:  make(map[string]bool),
+	}, nil
+}
+
+// parseAuthConfig parses registry credentials in the format of the Docker
+// CLI config.json.
+func parseAuthConfig(data []byte) (map[string]types.AuthConfig, error) {
+	var config struct {
+		Auths map[string]types.AuthConfig `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("cannot parse registry auth config: %v", err)
+	}
+	for server, auth := range config.Auths {
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decode auth for %s: %v", server, err)
+			}
+			auth.Username, auth.Password, _ = strings.Cut(string(decoded), ":")
+			auth.Auth = ""
+		}
+		auth.ServerAddress = server
+		config.Auths[server] = auth
+	}
+	return config.Auths, nil
+}
+
+func (c *imageChecker) run() {
+	for {
+		c.check()
+		time.Sleep(c.interval)
+	}
+}
+
+func (c *imageChecker) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	containers, err := c.docker.ContainerList(
+		ctx,
+		types.ContainerListOptions{Filters: filters.NewArgs(filters.Arg("status", "running"))},
+	)
+	if err != nil {
+		log.Printf("cannot list containers for image check: %v", err)
+		return
+	}
+
+	results := make(map[string]bool)
+	remoteDigests := make(map[string]string)
+	for _, container := range containers {
+		if strings.HasPrefix(container.Image, "sha256:") {
+			continue
+		}
+		remoteDigest, ok := remoteDigests[container.Image]
+		if !ok {
+			remoteDigest, err = c.remoteDigest(container.Image)
+			if err != nil {
+				log.Printf("cannot get registry digest of %s: %v", container.Image, err)
+			}
+			remoteDigests[container.Image] = remoteDigest
+		}
+		if remoteDigest == "" {
+			continue
+		}
+		image, err := c.inspectImage(container.ImageID)
+		if err != nil {
+			log.Printf("cannot inspect image %s: %v", container.ImageID, err)
+			continue
+		}
+		upToDate := false
+		for _, repoDigest := range image.RepoDigests {
+			if _, digest, _ := strings.Cut(repoDigest, "@"); digest == remoteDigest {
+				upToDate = true
+			}
+		}
+		results[container.ID] = upToDate
+	}
+
+	c.mu.Lock()
+	c.results = results
+	c.mu.Unlock()
+}
+
+func (c *imageChecker) remoteDigest(image string) (string, error) {
+	encodedAuth := ""
+	if auth, ok := c.auths[registryAuthKey(image)]; ok {
+		data, err := json.Marshal(auth)
+		if err != nil {
+			return "", err
+		}
+		encodedAuth = base64.URLEncoding.EncodeToString(data)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	distribution, err := c.docker.DistributionInspect(ctx, image, encodedAuth)
+	if err != nil {
+		return "", err
+	}
+	return distribution.Descriptor.Digest.String(), nil
+}
+
+func (c *imageChecker) inspectImage(imageID string) (types.ImageInspect, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	image, _, err := c.docker.ImageInspectWithRaw(ctx, imageID)
+	return image, err
+}
+
+// upToDate reports whether the image of a container matches the registry,
+// and whether the container has been checked at all.
+func (c *imageChecker) upToDate(containerID string) (upToDate, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	upToDate, ok = c.results[containerID]
+	return upToDate, ok
+}
+
+// registryAuthKey returns the key of the registry hosting image in the
+// auths of a Docker CLI config.json.
+func registryAuthKey(image string) string {
+	domain, _, found := strings.Cut(image, "/")
+	if !found || (!strings.ContainsAny(domain, ".:") && domain != "localhost") {
+		return dockerHubAuthKey
+	}
+	if domain == "docker.io" || domain == "index.docker.io" {
+		return dockerHubAuthKey
+	}
+	return domain
+}
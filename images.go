@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const imageListTimeout = 10 * time.Second
+
+// imageCollector collects the images of the Docker daemon, with a series for
+// each repository and tag of tagged images, and a single series with empty
+// repository and tag for untagged images.
+type imageCollector struct {
+	docker *client.Client
+}
+
+// Describe describes no metrics, so that the images are not listed when the
+// collector is registered.
+func (c *imageCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *imageCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), imageListTimeout)
+	defer cancel()
+	images, err := c.docker.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		log.Printf("cannot list images: %v", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+		"docker_images_total", "",
+		nil, nil),
+		prometheus.GaugeValue,
+		float64(len(images)))
+
+	for _, image := range images {
+		repoTags := image.RepoTags
+		if len(repoTags) == 0 {
+			repoTags = []string{""}
+		}
+		for _, repoTag := range repoTags {
+			repository, tag := splitRepoTag(repoTag)
+			ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+				"docker_image_size_bytes", "",
+				[]string{"image_id", "repository", "tag"}, nil),
+				prometheus.GaugeValue,
+				float64(image.Size),
+				image.ID, repository, tag)
+			ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+				"docker_image_created_timestamp_seconds", "",
+				[]string{"image_id", "repository", "tag"}, nil),
+				prometheus.GaugeValue,
+				float64(image.Created),
+				image.ID, repository, tag)
+		}
+	}
+}
+
+// splitRepoTag splits a repository and tag such as "localhost:5000/app:v1",
+// returning empty strings for the "<none>:<none>" of untagged images.
+func splitRepoTag(repoTag string) (repository, tag string) {
+	if repoTag == "<none>:<none>" {
+		return "", ""
+	}
+	i := strings.LastIndex(repoTag, ":")
+	if i < 0 || strings.Contains(repoTag[i+1:], "/") {
+		return repoTag, ""
+	}
+	return repoTag[:i], repoTag[i+1:]
+}
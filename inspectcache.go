@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+)
+
+// inspectCache keeps the inspect results of non-running containers, which
+// only change with the events of the containers, such as when they are
+// started and exit again between two scrapes, or are updated. Cached results
+// are removed on every event of their container, and dropped when the state
+// of the container listed differs in case an event is missed.
+type inspectCache struct {
+	mu   sync.Mutex
+	byID map[string]cachedInspect
+}
+
+type cachedInspect struct {
+	state         string
+	containerJson types.ContainerJSON
+}
+
+func newInspectCache() *inspectCache {
+	return &inspectCache{byID: make(map[string]cachedInspect)}
+}
+
+// get returns the cached inspect result of a container, if it was cached in
+// the current state of the container.
+func (c *inspectCache) get(container *types.Container) (types.ContainerJSON, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.byID[container.ID]
+	if !ok || cached.state != container.State {
+		return types.ContainerJSON{}, false
+	}
+	return cached.containerJson, true
+}
+
+func (c *inspectCache) put(container *types.Container, containerJson types.ContainerJSON) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.byID[container.ID] = cachedInspect{container.State, containerJson}
+}
+
+// handleEvent removes the cached inspect result of the container of an
+// event, whose exit code, start and finish times, or limits may have
+// changed.
+func (c *inspectCache) handleEvent(message events.Message) {
+	if message.Type != events.ContainerEventType {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.byID, message.Actor.ID)
+}
+
+// retain removes the cached inspect results of containers not in containers.
+func (c *inspectCache) retain(containers []types.Container) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	listed := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		listed[container.ID] = true
+	}
+	for id := range c.byID {
+		if !listed[id] {
+			delete(c.byID, id)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+//go:build integration
+
+// The integration tests run the exporter against the Docker daemon of the
+// environment, such as DOCKER_HOST, creating and removing their own
+// containers from the image in INTEGRATION_IMAGE (busybox by default):
+//
+//	go test -tags integration -count=1 ./...
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const integrationLabel = "docker-stats-exporter.integration"
+
+func integrationImage() string {
+	if os.Getenv("INTEGRATION_IMAGE") != "" {
+		return os.Getenv("INTEGRATION_IMAGE")
+	}
+	return "busybox:latest"
+}
+
+func integrationClient(t *testing.T) *client.Client {
+	t.Helper()
+	docker, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		t.Fatalf("cannot create Docker client: %v", err)
+	}
+	t.Cleanup(func() { docker.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := docker.Ping(ctx); err != nil {
+		t.Fatalf("cannot connect to the Docker daemon: %v", err)
+	}
+	return docker
+}
+
+// startContainer creates a container running the integration image with the
+// labels, started unless start is false, and removed at the end of the test.
+func startContainer(t *testing.T, docker *client.Client, labels map[string]string, start bool) string {
+	t.Helper()
+	ctx := context.Background()
+
+	image := integrationImage()
+	if _, _, err := docker.ImageInspectWithRaw(ctx, image); client.IsErrNotFound(err) {
+		progress, err := docker.ImagePull(ctx, image, types.ImagePullOptions{})
+		if err != nil {
+			t.Fatalf("cannot pull %s: %v", image, err)
+		}
+		io.Copy(io.Discard, progress)
+		progress.Close()
+	} else if err != nil {
+		t.Fatalf("cannot inspect %s: %v", image, err)
+	}
+
+	allLabels := map[string]string{integrationLabel: t.Name()}
+	for key, value := range labels {
+		allLabels[key] = value
+	}
+	name := fmt.Sprintf("dse-integration-%d-%d", os.Getpid(), time.Now().UnixNano())
+	created, err := docker.ContainerCreate(ctx, &container.Config{
+		Image:  image,
+		Cmd:    []string{"sleep", "300"},
+		Labels: allLabels,
+	}, &container.HostConfig{}, nil, nil, name)
+	if err != nil {
+		t.Fatalf("cannot create container: %v", err)
+	}
+	t.Cleanup(func() {
+		docker.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{Force: true})
+	})
+	if start {
+		if err := docker.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+			t.Fatalf("cannot start container: %v", err)
+		}
+	}
+	return name
+}
+
+// scrapeExporter scrapes an exporter configured from the environment, set
+// with t.Setenv before.
+func scrapeExporter(t *testing.T) map[string]*dto.MetricFamily {
+	t.Helper()
+	server := httptest.NewServer(newMetricsHandler(newExporterFromEnv()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("cannot scrape exporter: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("scrape failed with status %d: %s", resp.StatusCode, body)
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		t.Fatalf("cannot parse metrics: %v", err)
+	}
+	return families
+}
+
+// findMetric returns the metric of a family with the given label values.
+func findMetric(families map[string]*dto.MetricFamily, name string, labels map[string]string) *dto.Metric {
+	family, ok := families[name]
+	if !ok {
+		return nil
+	}
+	for _, metric := range family.Metric {
+		matches := 0
+		for _, pair := range metric.Label {
+			if value, ok := labels[pair.GetName()]; ok && value == pair.GetValue() {
+				matches++
+			}
+		}
+		if matches == len(labels) {
+			return metric
+		}
+	}
+	return nil
+}
+
+func metricValue(metric *dto.Metric) float64 {
+	switch {
+	case metric.Gauge != nil:
+		return metric.Gauge.GetValue()
+	case metric.Counter != nil:
+		return metric.Counter.GetValue()
+	}
+	return metric.Untyped.GetValue()
+}
+
+func TestIntegrationRunningContainer(t *testing.T) {
+	docker := integrationClient(t)
+	name := startContainer(t, docker, nil, true)
+
+	families := scrapeExporter(t)
+	labels := map[string]string{"name": name}
+	for _, tc := range []struct {
+		metric string
+		min    float64
+	}{
+		{"docker_container_info", 1},
+		{"docker_container_cpu_seconds_total", 0},
+		{"docker_container_memory_usage_bytes", 0},
+		{"docker_container_memory_limit_bytes", 1},
+		{"docker_container_pids", 1},
+		{"docker_container_network_rx_bytes_total", 0},
+	} {
+		metric := findMetric(families, tc.metric, labels)
+		if metric == nil {
+			t.Errorf("%s missing for %s", tc.metric, name)
+			continue
+		}
+		if value := metricValue(metric); value < tc.min {
+			t.Errorf("%s of %s is %v, want at least %v", tc.metric, name, value, tc.min)
+		}
+	}
+}
+
+func TestIntegrationStoppedContainer(t *testing.T) {
+	docker := integrationClient(t)
+	name := startContainer(t, docker, nil, false)
+
+	families := scrapeExporter(t)
+	labels := map[string]string{"name": name}
+	if findMetric(families, "docker_container_info", labels) == nil {
+		t.Errorf("docker_container_info missing for %s", name)
+	}
+	if findMetric(families, "docker_container_cpu_seconds_total", labels) != nil {
+		t.Errorf("docker_container_cpu_seconds_total exported for created container %s", name)
+	}
+}
+
+func TestIntegrationCustomLabel(t *testing.T) {
+	docker := integrationClient(t)
+	name := startContainer(t, docker, map[string]string{"team": "payments"}, true)
+	t.Setenv("LABEL_team", `{{index .Container.Labels "team"}}`)
+
+	families := scrapeExporter(t)
+	labels := map[string]string{"name": name, "team": "payments"}
+	if findMetric(families, "docker_container_cpu_seconds_total", labels) == nil {
+		t.Errorf("docker_container_cpu_seconds_total missing for %s with team label", name)
+	}
+}
+
+func TestIntegrationCollectionInterval(t *testing.T) {
+	docker := integrationClient(t)
+	name := startContainer(t, docker, map[string]string{intervalLabel: "1h"}, true)
+
+	e := newExporterFromEnv()
+	server := httptest.NewServer(newContainerMetricsHandler(e))
+	defer server.Close()
+	for i := 0; i < 2; i++ {
+		before := e.transport.requests.Load()
+		resp, err := http.Get(server.URL + "/containers/" + name + "/metrics")
+		if err != nil {
+			t.Fatalf("cannot scrape exporter: %v", err)
+		}
+		resp.Body.Close()
+		requests := e.transport.requests.Load() - before
+		// listing the containers, then inspecting and getting the stats of
+		// the container on the first scrape only
+		if i == 0 && requests < 3 || i == 1 && requests != 1 {
+			t.Errorf("scrape %d made %d Docker API requests", i+1, requests)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// intervalLabel is the label of containers setting the minimum interval
+// between their collections, such as "60s".
+const intervalLabel = "docker-stats-exporter.interval"
+
+// containerInterval returns the collection interval set by the label of a
+// container, or 0 if not set.
+func containerInterval(container *types.Container) (time.Duration, error) {
+	value, ok := container.Labels[intervalLabel]
+	if !ok {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		return 0, &collectError{reasonConfig, fmt.Errorf("invalid %s label %q: must be a positive duration", intervalLabel, value)}
+	}
+	return interval, nil
+}
+
+// sampleCache keeps the metrics of the last collection of containers with a
+// collection interval, served again by scrapes until the interval elapses.
+type sampleCache struct {
+	mu   sync.Mutex
+	byID map[string]cachedSample
+}
+
+type cachedSample struct {
+	state   string
+	time    time.Time
+	metrics []prometheus.Metric
+	usage   *groupUsage
+}
+
+func newSampleCache() *sampleCache {
+	return &sampleCache{byID: make(map[string]cachedSample)}
+}
+
+// get returns the cached sample of a container, if it was collected in the
+// current state of the container less than interval ago.
+func (c *sampleCache) get(container *types.Container, interval time.Duration) (cachedSample, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.byID[container.ID]
+	if !ok || cached.state != container.State || time.Since(cached.time) >= interval {
+		return cachedSample{}, false
+	}
+	return cached, true
+}
+
+func (c *sampleCache) put(container *types.Container, sample cachedSample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.byID[container.ID] = sample
+}
+
+// handleEvent removes the cached sample of containers changed by docker
+// update, so that their new limits are collected by the next scrape.
+func (c *sampleCache) handleEvent(message events.Message) {
+	if message.Type != events.ContainerEventType || message.Action != "update" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.byID, message.Actor.ID)
+}
+
+// retain removes the cached samples of containers not in containers.
+func (c *sampleCache) retain(containers []types.Container) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	listed := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		listed[container.ID] = true
+	}
+	for id := range c.byID {
+		if !listed[id] {
+			delete(c.byID, id)
+		}
+	}
+}
+
+// collectSampled collects a container like collectContainer, keeping its
+// metrics and resource usage in the sample cache.
+func (e *exporter) collectSampled(ctx context.Context, container *types.Container, opts collectOptions, usage *groupUsage, ch chan<- prometheus.Metric) error {
+	sample := cachedSample{state: container.State, time: time.Now(), usage: newGroupUsage(e.groups)}
+	metrics := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for metric := range metrics {
+			sample.metrics = append(sample.metrics, metric)
+			ch <- metric
+		}
+		close(done)
+	}()
+	// collected in full, since the sample is also served for other subsets
+	err := e.collectContainer(ctx, container, collectOptions{templateErrors: opts.templateErrors}, sample.usage, metrics)
+	close(metrics)
+	<-done
+
+	usage.merge(sample.usage)
+	if err == nil {
+		e.samples.put(container, sample)
+	}
+	return err
+}
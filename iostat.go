@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+)
+
+// ioStatOps maps the keys of io.stat to the blkio operations and whether
+// they count bytes or operations.
+var ioStatOps = map[string]struct {
+	op    string
+	bytes bool
+}{
+	"rbytes": {"read", true},
+	"wbytes": {"write", true},
+	"dbytes": {"discard", true},
+	"rios":   {"read", false},
+	"wios":   {"write", false},
+	"dios":   {"discard", false},
+}
+
+// ioStatWarning logs the first failure to read io.stat only, since it fails
+// for all containers when the cgroup filesystem of the host is not mounted.
+var ioStatWarning sync.Once
+
+// fillIOStat fills the empty blkio stats returned by some daemons on cgroup
+// v2 hosts from the io.stat file of the cgroup of the container.
+func (e *exporter) fillIOStat(ctx context.Context, containerJson types.ContainerJSON, stats *types.StatsJSON) {
+	if len(stats.BlkioStats.IoServiceBytesRecursive) > 0 || len(stats.BlkioStats.IoServicedRecursive) > 0 {
+		return
+	}
+	if _, version, err := e.cgroups.detect(ctx); err != nil || version != "2" {
+		return
+	}
+	dir, err := e.cgroups.dir(ctx, containerJson, "")
+	if err == nil {
+		stats.BlkioStats.IoServiceBytesRecursive, stats.BlkioStats.IoServicedRecursive, err = readIOStat(filepath.Join(dir, "io.stat"))
+	}
+	if err != nil {
+		ioStatWarning.Do(func() {
+			log.Printf("cannot read io.stat for empty block I/O stats, block I/O counters are zero: %v", err)
+		})
+	}
+}
+
+// readIOStat parses an io.stat file of cgroup v2 into blkio stats entries of
+// bytes and operations, with a line of keyed counters for each device such
+// as "8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0 dios=0".
+func readIOStat(path string) (serviceBytes, serviced []types.BlkioStatEntry, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		majorText, minorText, ok := strings.Cut(fields[0], ":")
+		major, majorErr := strconv.ParseUint(majorText, 10, 64)
+		minor, minorErr := strconv.ParseUint(minorText, 10, 64)
+		if !ok || majorErr != nil || minorErr != nil {
+			return nil, nil, fmt.Errorf("invalid device %q in %s", fields[0], path)
+		}
+		for _, field := range fields[1:] {
+			key, text, _ := strings.Cut(field, "=")
+			stat, ok := ioStatOps[key]
+			if !ok {
+				continue
+			}
+			value, err := strconv.ParseUint(text, 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid %s of device %s in %s", key, fields[0], path)
+			}
+			entry := types.BlkioStatEntry{Major: major, Minor: minor, Op: stat.op, Value: value}
+			if stat.bytes {
+				serviceBytes = append(serviceBytes, entry)
+			} else {
+				serviced = append(serviced, entry)
+			}
+		}
+	}
+	return serviceBytes, serviced, scanner.Err()
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultLabelMaxLength and defaultTemplateTimeout are the default limits of
+// the execution of label templates.
+const (
+	defaultLabelMaxLength  = 1024
+	defaultTemplateTimeout = 100 * time.Millisecond
+)
+
+var (
+	errLabelTooLong    = errors.New("label value too long")
+	errTemplateTimeout = errors.New("label template timed out")
+)
+
+// labelLimits bounds the execution of label templates, so that a
+// pathological template cannot block a scrape or export huge label values:
+// the templates of a container are executed with a timeout, and label values
+// longer than the maximum length are truncated. Templates cannot be stopped
+// once started, so a template timing out keeps running in the background
+// until it finishes, and is skipped in the meantime.
+type labelLimits struct {
+	maxLength int
+	timeout   time.Duration
+
+	mu        sync.Mutex
+	truncated map[string]uint64
+	timeouts  map[string]uint64
+	// running are the labels whose templates timed out and are still
+	// running
+	running map[string]bool
+}
+
+func newLabelLimits(maxLength int, timeout time.Duration) *labelLimits {
+	return &labelLimits{
+		maxLength: maxLength,
+		timeout:   timeout,
+		truncated: make(map[string]uint64),
+		timeouts:  make(map[string]uint64),
+		running:   make(map[string]bool),
+	}
+}
+
+// labelResult is the value of a label, with an error if its template failed
+// or its output was truncated.
+type labelResult struct {
+	index int
+	value string
+	err   error
+}
+
+// values returns the values of labels for a container, with an error for
+// each label whose template failed, was truncated, or did not finish within
+// the timeout. The values of labels not finished within the timeout are
+// empty.
+func (l *labelLimits) values(labels []labelTemplate, container *types.Container, containerJson types.ContainerJSON) ([]string, []error) {
+	values := make([]string, len(labels))
+	errs := make([]error, len(labels))
+	finished := make([]bool, len(labels))
+
+	l.mu.Lock()
+	for i, label := range labels {
+		if l.running[label.name] {
+			finished[i] = true
+			errs[i] = errors.New("skipped, still running after timing out")
+		}
+	}
+	l.mu.Unlock()
+
+	// the templates are executed in order by a single goroutine, and the
+	// state shared with it is guarded by l.mu
+	results := make(chan labelResult, len(labels))
+	timedOut := new(atomic.Bool)
+	current := -1
+	go func() {
+		defer close(results)
+		buffer := labelBuffers.Get().(*bytes.Buffer)
+		defer labelBuffers.Put(buffer)
+		writer := &labelWriter{limits: l, buffer: buffer, timedOut: timedOut}
+		data := &labelTemplateData{container, containerJson}
+		for i, label := range labels {
+			l.mu.Lock()
+			if finished[i] || timedOut.Load() {
+				l.mu.Unlock()
+				if timedOut.Load() {
+					return
+				}
+				continue
+			}
+			current = i
+			l.mu.Unlock()
+
+			value, err := writer.execute(label, data)
+
+			l.mu.Lock()
+			if timedOut.Load() {
+				delete(l.running, label.name)
+				l.mu.Unlock()
+				return
+			}
+			results <- labelResult{i, value, err}
+			l.mu.Unlock()
+		}
+	}()
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	receive := func(result labelResult) {
+		values[result.index], errs[result.index] = result.value, result.err
+		finished[result.index] = true
+	}
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				return values, errs
+			}
+			l.mu.Lock()
+			receive(result)
+			l.mu.Unlock()
+		case <-timer.C:
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			timedOut.Store(true)
+			for len(results) > 0 {
+				receive(<-results)
+			}
+			if current >= 0 && !finished[current] {
+				l.running[labels[current].name] = true
+				l.timeouts[labels[current].name]++
+				errs[current] = fmt.Errorf("%w after %v", errTemplateTimeout, l.timeout)
+				finished[current] = true
+			}
+			for i := range labels {
+				if !finished[i] {
+					errs[i] = fmt.Errorf("not executed within %v", l.timeout)
+				}
+			}
+			return values, errs
+		}
+	}
+}
+
+// execute returns the value of a label for a container, outside of the
+// collection of metrics.
+func (l *labelLimits) execute(label labelTemplate, container *types.Container, containerJson types.ContainerJSON) (string, error) {
+	values, errs := l.values([]labelTemplate{label}, container, containerJson)
+	return values[0], errs[0]
+}
+
+func (l *labelLimits) collect(ch chan<- prometheus.Metric) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for label, truncated := range l.truncated {
+		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+			"docker_exporter_label_truncations_total", "",
+			[]string{"label"}, nil),
+			prometheus.CounterValue,
+			float64(truncated),
+			label)
+	}
+	for label, timeouts := range l.timeouts {
+		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+			"docker_exporter_label_template_timeouts_total", "",
+			[]string{"label"}, nil),
+			prometheus.CounterValue,
+			float64(timeouts),
+			label)
+	}
+	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+		"docker_exporter_label_templates_running", "",
+		nil, nil),
+		prometheus.GaugeValue,
+		float64(len(l.running)))
+}
+
+// labelWriter is the output of label templates, failing a template once the
+// maximum length of label values is reached, or once its execution timed out.
+type labelWriter struct {
+	limits   *labelLimits
+	buffer   *bytes.Buffer
+	timedOut *atomic.Bool
+}
+
+// execute returns the value of a label, with an error if the template failed
+// or its output was truncated.
+func (w *labelWriter) execute(label labelTemplate, data *labelTemplateData) (string, error) {
+	w.buffer.Reset()
+	err := label.template.Execute(w, data)
+	value := w.buffer.String()
+	if errors.Is(err, errLabelTooLong) {
+		w.limits.mu.Lock()
+		w.limits.truncated[label.name]++
+		w.limits.mu.Unlock()
+		return value, fmt.Errorf("output longer than %d bytes, truncated", w.limits.maxLength)
+	}
+	return value, err
+}
+
+func (w *labelWriter) Write(p []byte) (int, error) {
+	if w.timedOut.Load() {
+		return 0, errTemplateTimeout
+	}
+	if remaining := w.limits.maxLength - w.buffer.Len(); len(p) > remaining {
+		// truncated at the start of a rune to keep the value valid UTF-8
+		n := remaining
+		for n > 0 && !utf8.RuneStart(p[n]) {
+			n--
+		}
+		w.buffer.Write(p[:n])
+		return n, errLabelTooLong
+	}
+	return w.buffer.Write(p)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// layerSizer measures the on-disk size of the writable layer of overlay2
+// containers, walking their upper directory on the host filesystem mounted at
+// rootPath in the background at most once per interval.
+type layerSizer struct {
+	rootPath string
+	interval time.Duration
+
+	mu   sync.Mutex
+	byID map[string]*layerSize
+}
+
+type layerSize struct {
+	size     int64
+	measured time.Time
+	running  bool
+}
+
+func newLayerSizer(rootPath string, interval time.Duration) *layerSizer {
+	return &layerSizer{
+		rootPath: rootPath,
+		interval: interval,
+		byID:     make(map[string]*layerSize),
+	}
+}
+
+// size returns the last measured size of the writable layer of a container,
+// starting a new measurement when it is older than the interval.
+func (s *layerSizer) size(containerJson types.ContainerJSON) (int64, bool) {
+	if containerJson.GraphDriver.Name != "overlay2" || containerJson.GraphDriver.Data["UpperDir"] == "" {
+		return 0, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	layer, ok := s.byID[containerJson.ID]
+	if !ok {
+		layer = &layerSize{}
+		s.byID[containerJson.ID] = layer
+	}
+	if !layer.running && time.Since(layer.measured) >= s.interval {
+		layer.running = true
+		go s.measure(layer, containerJson.GraphDriver.Data["UpperDir"])
+	}
+	return layer.size, !layer.measured.IsZero()
+}
+
+func (s *layerSizer) measure(layer *layerSize, upperDir string) {
+	var size int64
+	root := filepath.Join(s.rootPath, upperDir)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		// files removed by the container while walking are skipped
+		if errors.Is(err, fs.ErrNotExist) && path != root {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			size += diskUsage(info)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("cannot measure writable layer %s: %v", upperDir, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	layer.running = false
+	// failed measurements are retried at the next scrape rather than after
+	// the interval
+	if err == nil {
+		layer.size = size
+		layer.measured = time.Now()
+	}
+}
+
+// retain removes the sizes of containers not in containers.
+func (s *layerSizer) retain(containers []types.Container) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	listed := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		listed[container.ID] = true
+	}
+	for id := range s.byID {
+		if !listed[id] {
+			delete(s.byID, id)
+		}
+	}
+}
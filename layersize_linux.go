@@ -0,0 +1,17 @@
+//go:build linux
+
+package main
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// diskUsage returns the space allocated to a file on disk, which is less than
+// its size for sparse files.
+func diskUsage(info fs.FileInfo) int64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Blocks * 512
+	}
+	return info.Size()
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "io/fs"
+
+func diskUsage(info fs.FileInfo) int64 {
+	return info.Size()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var lifetimeBuckets = []float64{1, 5, 10, 30, 60, 300, 900, 3600, 4 * 3600, 24 * 3600}
+
+// lifetimeInspectTimeout is the timeout of the inspection of containers
+// created before the exporter started.
+const lifetimeInspectTimeout = 10 * time.Second
+
+// lifetimeTracker observes the lifetime of containers, from their creation to
+// their death, by image and Compose service.
+type lifetimeTracker struct {
+	docker    *client.Client
+	histogram *prometheus.HistogramVec
+
+	mu      sync.Mutex
+	created map[string]time.Time
+}
+
+func newLifetimeTracker(docker *client.Client) *lifetimeTracker {
+	return &lifetimeTracker{
+		docker: docker,
+		histogram: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "docker_container_lifetime_seconds",
+			Buckets: lifetimeBuckets,
+		}, []string{"image", "compose_service"}),
+		created: make(map[string]time.Time),
+	}
+}
+
+func (t *lifetimeTracker) handleEvent(message events.Message) {
+	if message.Type != events.ContainerEventType {
+		return
+	}
+	switch message.Action {
+	case "create":
+		t.mu.Lock()
+		t.created[message.Actor.ID] = eventTime(message)
+		t.mu.Unlock()
+	case "die":
+		t.mu.Lock()
+		created, ok := t.created[message.Actor.ID]
+		t.mu.Unlock()
+		if !ok {
+			// created before the exporter started, inspected without
+			// blocking the handling of events
+			go t.observeInspected(message)
+			return
+		}
+		t.observe(message, created)
+	case "destroy":
+		t.mu.Lock()
+		delete(t.created, message.Actor.ID)
+		t.mu.Unlock()
+	}
+}
+
+// observeInspected observes the lifetime of a container given its creation
+// time from its inspect result.
+func (t *lifetimeTracker) observeInspected(message events.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), lifetimeInspectTimeout)
+	defer cancel()
+	containerJson, err := t.docker.ContainerInspect(ctx, message.Actor.ID)
+	if err != nil {
+		return
+	}
+	created, err := time.Parse(time.RFC3339Nano, containerJson.Created)
+	if err != nil {
+		return
+	}
+	t.observe(message, created)
+}
+
+func (t *lifetimeTracker) observe(message events.Message, created time.Time) {
+	t.histogram.WithLabelValues(
+		message.Actor.Attributes["image"],
+		message.Actor.Attributes["com.docker.compose.service"],
+	).Observe(eventTime(message).Sub(created).Seconds())
+}
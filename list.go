@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docker/docker/api/types"
+)
+
+// listCommand prints the containers known to the daemon, whether they are
+// exported, and the resolved values of their labels.
+func listCommand(e *exporter, args []string) int {
+	ctx := context.Background()
+	containers, err := e.docker.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot list containers: %v\n", err)
+		return 1
+	}
+	sortContainers(containers)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "NAME\tSTATE\tEXPORTED\tLABELS")
+	for _, container := range containers {
+		container := container
+		exported := "yes"
+		if reason := e.exclusionReason(&container); reason != "" {
+			exported = "no (" + reason + ")"
+		}
+
+		labels := "-"
+		containerJson, err := e.docker.ContainerInspect(ctx, container.ID)
+		if err != nil {
+			labels = fmt.Sprintf("cannot inspect: %v", err)
+		} else if labelsNames, labelsValues := e.labels(&container, containerJson, nil); len(labelsNames) > 1 {
+			pairs := []string{}
+			for i := 1; i < len(labelsNames); i++ {
+				pairs = append(pairs, fmt.Sprintf("%s=%q", labelsNames[i], labelsValues[i]))
+			}
+			labels = strings.Join(pairs, " ")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", containerName(&container), container.State, exported, labels)
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// listenConfig is an address to serve HTTP on, over TLS if tlsConfig is set.
+type listenConfig struct {
+	addr      string
+	tlsConfig *tls.Config
+}
+
+// listenConfigs returns the addresses to serve HTTP on: the addresses of
+// ADDR, and the address of TLS_ADDR served over TLS, requiring client
+// certificates signed by TLS_CLIENT_CA_FILE if set.
+func listenConfigs() ([]listenConfig, error) {
+	configs := []listenConfig{}
+	for _, addr := range listenAddrs() {
+		configs = append(configs, listenConfig{addr: addr})
+	}
+
+	if getenv("TLS_ADDR") != "" {
+		cert, err := tls.LoadX509KeyPair(getenv("TLS_CERT_FILE"), getenv("TLS_KEY_FILE"))
+		if err != nil {
+			return nil, fmt.Errorf("cannot load TLS_CERT_FILE and TLS_KEY_FILE: %v", err)
+		}
+		tlsConfig := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		if getenv("TLS_CLIENT_CA_FILE") != "" {
+			data, err := os.ReadFile(getenv("TLS_CLIENT_CA_FILE"))
+			if err != nil {
+				return nil, fmt.Errorf("cannot read TLS_CLIENT_CA_FILE: %v", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("no certificates in TLS_CLIENT_CA_FILE")
+			}
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		configs = append(configs, listenConfig{addr: getenv("TLS_ADDR"), tlsConfig: tlsConfig})
+	}
+
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no address to listen on in ADDR")
+	}
+	return configs, nil
+}
+
+// listen opens the listener of the address, which is served over TLS if
+// configured.
+func (c listenConfig) listen() (net.Listener, error) {
+	listener, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	if c.tlsConfig != nil {
+		listener = tls.NewListener(listener, c.tlsConfig)
+	}
+	return listener, nil
+}
+
+func (c listenConfig) String() string {
+	if c.tlsConfig != nil {
+		return "https://" + c.addr
+	}
+	return "http://" + c.addr
+}
+
+// serveListeners serves HTTP requests on all the listeners until one of them
+// fails.
+func serveListeners(listeners []net.Listener, handler http.Handler) error {
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		listener := listener
+		go func() {
+			errs <- fmt.Errorf("%s: %v", listener.Addr(), http.Serve(listener, handler))
+		}()
+	}
+	return <-errs
+}
@@ -3,11 +3,19 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"text/template"
@@ -15,200 +23,1062 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/errgroup"
 )
 
+const healthOutputMaxLength = 64
+
+// defaultCPUPeriod and defaultCPUShares are the CPU period in microseconds
+// and CPU shares of containers not setting them.
+const (
+	defaultCPUPeriod = 100000
+	defaultCPUShares = 1024
+)
+
+// normalizedNameLabel is the label of the names normalized by NAME_NORMALIZE.
+const normalizedNameLabel = "normalized_name"
+
+// defaultConcurrency is the default number of containers collected at once.
+const defaultConcurrency = 16
+
+// labelBuffers are the buffers reused across label template executions.
+var labelBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+var defaultSensitiveMounts = []string{
+	"/",
+	"/dev",
+	"/etc",
+	"/proc",
+	"/root",
+	"/run/docker.sock",
+	"/sys",
+	"/var/lib/docker",
+	"/var/run/docker.sock",
+}
+
+// labelTemplate is the template of a custom label.
+type labelTemplate struct {
+	name     string
+	template *template.Template
+}
+
+// labelTemplateData is the data in scope of custom label templates.
+type labelTemplateData struct {
+	Container     *types.Container
+	ContainerJSON types.ContainerJSON
+}
+
 type exporter struct {
-	docker      *client.Client
-	extraLabels map[string]*template.Template
+	docker            *client.Client
+	transport         *dockerTransport
+	extraLabels       []labelTemplate
+	nameNormalize     *regexp.Regexp
+	healthOutput      string
+	unlimitedMemory   string
+	commandInfo       string
+	envHashVars       []string
+	envHashKey        []byte
+	groups            []containerGroup
+	groupCPU          *groupCPU
+	sensitiveMounts   []string
+	imageChecker      *imageChecker
+	shardIndex        uint32
+	shardTotal        uint32
+	labelGuard        *cardinalityGuard
+	labelLimits       *labelLimits
+	targets           *targetList
+	top               *topList
+	endpoints         *endpointList
+	history           *historyList
+	metricsSubsets    []metricsSubset
+	sampleTimestamps  bool
+	counterResets     *counterResets
+	degradations      *degradations
+	containerTimeout  time.Duration
+	statsMode         string
+	statsHistory      *statsHistory
+	blkioOps          bool
+	deviceNames       *deviceNames
+	procPath          string
+	networkInterfaces bool
+	networkPerIface   bool
+	networkFamilies   bool
+	conntrack         bool
+	processMetrics    bool
+	cpuMax            bool
+	nomadLabels       bool
+	balenaLabels      bool
+	balenaExclude     bool
+	selfContainer     string
+	selfID            string
+	concurrency       int
+	containerErrors   errorCounter
+	exclusions        exclusionCounter
+	inspectCache      *inspectCache
+	samples           *sampleCache
+	cgroups           *cgroups
+	pauses            *pauseTracker
+	ooms              *oomTracker
+	layerSizer        *layerSizer
+	fsSizer           *fsSizer
+	cgroupInfo        bool
+	cgroupLabel       bool
+	infoLabels        bool
+	collectors        []prometheus.Collector
+	gatherers         []prometheus.Gatherer
+	events            *eventWatcher
+	descs             sync.Map
 }
 
 func (e *exporter) Describe(ch chan<- *prometheus.Desc) {
 	// validate user-provided labels on a dummy metric
 	labels := []string{}
-	for label := range e.extraLabels {
-		labels = append(labels, label)
+	if e.nameNormalize != nil {
+		labels = append(labels, normalizedNameLabel)
+	}
+	for _, label := range e.extraLabels {
+		labels = append(labels, label.name)
+	}
+	if e.nomadLabels {
+		labels = append(labels, nomadLabelNames...)
+	}
+	if e.balenaLabels {
+		labels = append(labels, balenaLabelNames...)
 	}
 	ch <- prometheus.NewDesc("validate", "", labels, nil)
 }
 
+// collectOptions restricts what is collected by a collection round.
+type collectOptions struct {
+	// container is the name of the only container to collect, if not empty
+	container string
+	// metrics are the patterns of the names of the only metrics to serve,
+	// if not empty
+	metrics []string
+	// templateErrors logs the errors of label templates, if not nil
+	templateErrors *templateErrors
+}
+
 func (e *exporter) Collect(ch chan<- prometheus.Metric) {
+	e.collect(context.Background(), ch, collectOptions{})
+}
+
+func (e *exporter) collect(ctx context.Context, ch chan<- prometheus.Metric, opts collectOptions) {
 	containers, err := e.docker.ContainerList(
-		context.TODO(),
+		ctx,
 		types.ContainerListOptions{All: true},
 	)
+	if ctx.Err() != nil {
+		return
+	}
+	host := e.docker.DaemonHost()
+	if e.transport.failover != nil {
+		host = e.transport.failover.host()
+		e.transport.failover.recordEndpoints(e.endpoints)
+	}
+	e.endpoints.record(host, err)
+	// the metrics of the exporter are left out of the metrics of a single
+	// container
+	if opts.container == "" {
+		if e.transport.failover != nil {
+			defer e.transport.failover.collect(ch)
+		}
+		defer e.endpoints.collect(ch)
+		defer e.transport.versions.collect(ch)
+	}
 	if err != nil {
-		log.Fatalf("cannot list containers: %v", err)
+		log.Printf("cannot list containers: %v", err)
 		return
 	}
 
-	var wg sync.WaitGroup
+	sortContainers(containers)
+
+	if opts.container == "" {
+		containerNames.retain(containers)
+		e.targets.observe(containers, e.exclusionReason)
+		e.inspectCache.retain(containers)
+		e.samples.retain(containers)
+		e.statsHistory.retain(containers)
+		e.top.retain(containers)
+		if e.layerSizer != nil {
+			e.layerSizer.retain(containers)
+		}
+		if e.fsSizer != nil {
+			e.fsSizer.refresh()
+		}
+		if e.counterResets != nil {
+			e.counterResets.retain(containers)
+		}
+		e.degradations.retain(containers)
+		if opts.wants("docker_compose_") {
+			collectComposeHealth(containers, ch)
+		}
+		if opts.wants("docker_engine_cgroup_") {
+			e.cgroups.collect(ctx, ch)
+		}
+	}
+	if !opts.wants("docker_container_", "docker_group_") {
+		return
+	}
+
+	var usage *groupUsage
+	if opts.container == "" {
+		usage = newGroupUsage(e.groups)
+	}
+
+	var errs errorSummary
+	var g errgroup.Group
+	g.SetLimit(e.concurrency)
 	for _, container := range containers {
 		container := container
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			err := e.collectContainer(&container, ch)
+		if opts.container != "" && containerName(&container) != opts.container {
+			continue
+		}
+		if reason := e.exclusionReason(&container); reason != "" {
+			if opts.container == "" {
+				e.exclusions.add(reason)
+			}
+			continue
+		}
+		// non-running containers have no stats to get, and are collected
+		// without another goroutine when inspected previously
+		if containerJson, ok := e.inspectCache.get(&container); ok {
+			err := e.collectInspected(ctx, &container, containerJson, opts, usage, ch)
+			e.targets.collected(container.ID, err)
 			if err != nil {
-				log.Printf("cannot collect container %s: %v", container.ID, err)
+				errs.add(containerName(&container), errorReason(err), err)
 			}
-		}()
+			continue
+		}
+		// containers with a collection interval are served from their last
+		// collection until it elapses
+		interval, err := containerInterval(&container)
+		if err != nil {
+			e.targets.collected(container.ID, err)
+			errs.add(containerName(&container), errorReason(err), err)
+			continue
+		}
+		if sample, ok := e.samples.get(&container, interval); ok {
+			for _, metric := range sample.metrics {
+				ch <- metric
+			}
+			usage.merge(sample.usage)
+			continue
+		}
+		g.Go(func() error {
+			ctx := ctx
+			if e.containerTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, e.containerTimeout)
+				defer cancel()
+			}
+			var err error
+			if interval > 0 {
+				err = e.collectSampled(ctx, &container, opts, usage, ch)
+			} else {
+				err = e.collectContainer(ctx, &container, opts, usage, ch)
+			}
+			e.targets.collected(container.ID, err)
+			if err != nil {
+				reason := errorReason(err)
+				if ctx.Err() != nil {
+					reason = reasonTimeout
+				}
+				errs.add(containerName(&container), reason, err)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	e.containerErrors.add(&errs)
+	if n := errs.len(); n > 0 && ctx.Err() == nil {
+		log.Printf("cannot collect %d containers: %s", n, &errs)
+	}
+	if opts.container != "" {
+		return
+	}
+	e.groupCPU.accumulate(usage, containers)
+	usage.collect(ch)
+	e.containerErrors.collect(ch)
+	e.degradations.collect(ch)
+	e.exclusions.collect(ch)
+
+	if e.labelGuard != nil {
+		e.labelGuard.collect(ch)
 	}
-	wg.Wait()
+	e.labelLimits.collect(ch)
 }
 
-func (e *exporter) collectContainer(container *types.Container, ch chan<- prometheus.Metric) error {
-	containerJson, err := e.docker.ContainerInspect(context.TODO(), container.ID)
+func (e *exporter) collectContainer(ctx context.Context, container *types.Container, opts collectOptions, usage *groupUsage, ch chan<- prometheus.Metric) error {
+	containerJson, err := e.docker.ContainerInspect(ctx, container.ID)
 	if err != nil {
-		return err
+		return &collectError{reasonInspect, err}
 	}
+	if container.State != "running" {
+		e.inspectCache.put(container, containerJson)
+	}
+	return e.collectInspected(ctx, container, containerJson, opts, usage, ch)
+}
 
-	labelsNames := []string{"name"}
-	labelsValues := []string{strings.Trim(container.Names[0], "/")}
-	for labelName, labelTemplate := range e.extraLabels {
-		templateData := struct {
-			Container     *types.Container
-			ContainerJSON types.ContainerJSON
-		}{
-			container,
-			containerJson,
+// collectInspected collects a container given its inspect result, adding its
+// resource usage to the usage of its groups. The stats of the container are
+// not requested when none of the metrics collected from them are served.
+func (e *exporter) collectInspected(ctx context.Context, container *types.Container, containerJson types.ContainerJSON, opts collectOptions, usage *groupUsage, ch chan<- prometheus.Metric) (err error) {
+	labelsNames, labelsValues := e.labels(container, containerJson, opts.templateErrors)
+	if e.selfContainer == "label" {
+		labelsNames = append(labelsNames, "self")
+		labelsValues = append(labelsValues, strconv.FormatBool(e.isSelf(container.ID)))
+	}
+	if e.cgroupLabel {
+		_, version, err := e.cgroups.detect(ctx)
+		if err != nil {
+			return &collectError{reasonOther, fmt.Errorf("cannot detect cgroup version: %v", err)}
 		}
-		var labelValue bytes.Buffer
-		labelTemplate.Execute(&labelValue, templateData)
-		labelsNames = append(labelsNames, labelName)
-		labelsValues = append(labelsValues, labelValue.String())
+		labelsNames = append(labelsNames, "cgroup")
+		labelsValues = append(labelsValues, "v"+version)
+	}
+	m := e.newContainerMetrics(ch, container.ID, labelsNames, labelsValues)
+	if e.counterResets != nil {
+		m.startTime = containerStartTime(container, containerJson)
+		e.counterResets.begin(container.ID)
+		defer func() {
+			if err == nil {
+				e.counterResets.prune(container.ID)
+			}
+		}()
 	}
 
 	// Info
-	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
-		"docker_container_info", "",
-		labelsNames, nil),
-		prometheus.GaugeValue,
-		1,
-		labelsValues...)
+	if e.infoLabels {
+		infoNames, infoValues := []string{}, []string{}
+		for _, label := range [][2]string{
+			{"image", container.Image},
+			{"image_id", container.ImageID},
+			{"id", shortID(container.ID)},
+		} {
+			// labels set by the user take precedence
+			if !hasLabel(labelsNames, label[0]) {
+				infoNames = append(infoNames, label[0])
+				infoValues = append(infoValues, label[1])
+			}
+		}
+		m.sendWithLabels("docker_container_info", prometheus.GaugeValue, 1,
+			infoNames,
+			infoValues...)
+	} else {
+		m.send("docker_container_info", prometheus.GaugeValue, 1)
+	}
+
+	m.send("docker_container_created_timestamp_seconds", prometheus.GaugeValue, float64(container.Created))
+
+	// Command
+	if e.commandInfo != "" && containerJson.Config != nil {
+		if e.commandInfo == "truncate" {
+			m.sendWithLabels("docker_container_command_info", prometheus.GaugeValue, 1,
+				[]string{"command_hash", "command"},
+				commandHash(containerJson.Config), commandText(containerJson.Config))
+		} else {
+			m.sendWithLabels("docker_container_command_info", prometheus.GaugeValue, 1,
+				[]string{"command_hash"},
+				commandHash(containerJson.Config))
+		}
+	}
+
+	// Environment
+	if len(e.envHashVars) > 0 && containerJson.Config != nil {
+		m.sendWithLabels("docker_container_env_info", prometheus.GaugeValue, 1,
+			[]string{"env_hash"},
+			envHash(containerJson.Config.Env, e.envHashVars, e.envHashKey))
+	}
+
+	// Health
+	if containerJson.State != nil && containerJson.State.Health != nil {
+		for _, status := range []string{types.Healthy, types.Unhealthy, types.Starting} {
+			m.sendWithLabels("docker_container_health_status", prometheus.GaugeValue, boolToFloat(containerJson.State.Health.Status == status),
+				[]string{"status"},
+				status)
+		}
+
+		m.send("docker_container_health_failing_streak", prometheus.GaugeValue, float64(containerJson.State.Health.FailingStreak))
+	}
+
+	// Health output
+	if e.healthOutput != "" && containerJson.State != nil && containerJson.State.Health != nil {
+		if healthLog := containerJson.State.Health.Log; len(healthLog) > 0 {
+			m.sendWithLabels("docker_container_health_output_info", prometheus.GaugeValue, 1,
+				[]string{"output"},
+				e.formatHealthOutput(healthLog[len(healthLog)-1].Output))
+		}
+	}
+
+	// Resource limits
+	if containerJson.HostConfig != nil {
+		resources := containerJson.HostConfig.Resources
+
+		// --cpus is applied as a quota of the default period
+		period, quota := resources.CPUPeriod, resources.CPUQuota
+		if period == 0 {
+			period = defaultCPUPeriod
+		}
+		if resources.NanoCPUs > 0 {
+			quota = resources.NanoCPUs * period / 1e9
+		}
+		if quota > 0 {
+			m.send("docker_container_spec_cpu_quota", prometheus.GaugeValue, float64(quota))
+
+			m.send("docker_container_spec_cpu_period", prometheus.GaugeValue, float64(period))
+		}
+
+		shares := resources.CPUShares
+		if shares == 0 {
+			shares = defaultCPUShares
+		}
+		m.send("docker_container_spec_cpu_shares", prometheus.GaugeValue, float64(shares))
+
+		if resources.Memory > 0 {
+			m.send("docker_container_spec_memory_limit_bytes", prometheus.GaugeValue, float64(resources.Memory))
+		}
+		if resources.MemoryReservation > 0 {
+			m.send("docker_container_spec_memory_reservation_bytes", prometheus.GaugeValue, float64(resources.MemoryReservation))
+		}
+	}
+
+	// CPU set
+	if containerJson.HostConfig != nil && containerJson.HostConfig.CpusetCpus != "" {
+		// an unparsable cpuset only skips its metric, not the container
+		if cpus, err := cpusetSize(containerJson.HostConfig.CpusetCpus); err != nil {
+			log.Printf("cannot parse cpuset %q of container %s: %v", containerJson.HostConfig.CpusetCpus, containerName(container), err)
+		} else {
+			m.send("docker_container_cpuset_cpus", prometheus.GaugeValue, float64(cpus))
+		}
+	}
+
+	// Shared memory and tmpfs
+	if containerJson.HostConfig != nil {
+		if containerJson.HostConfig.ShmSize > 0 {
+			m.send("docker_container_shm_bytes", prometheus.GaugeValue, float64(containerJson.HostConfig.ShmSize))
+		}
+
+		tmpfsSizes := make(map[string]int64)
+		for path, options := range containerJson.HostConfig.Tmpfs {
+			if size, ok := tmpfsSize(options); ok {
+				tmpfsSizes[path] = size
+			}
+		}
+		for _, mount := range containerJson.HostConfig.Mounts {
+			if mount.Type == "tmpfs" && mount.TmpfsOptions != nil && mount.TmpfsOptions.SizeBytes > 0 {
+				tmpfsSizes[mount.Target] = mount.TmpfsOptions.SizeBytes
+			}
+		}
+		for path, size := range tmpfsSizes {
+			m.sendWithLabels("docker_container_tmpfs_size_bytes", prometheus.GaugeValue, float64(size),
+				[]string{"mountpoint"},
+				path)
+		}
+	}
+
+	// Security
+	if containerJson.HostConfig != nil && containerJson.Config != nil {
+		hostConfig := containerJson.HostConfig
+
+		m.send("docker_container_privileged", prometheus.GaugeValue, boolToFloat(hostConfig.Privileged))
+
+		m.send("docker_container_readonly_rootfs", prometheus.GaugeValue, boolToFloat(hostConfig.ReadonlyRootfs))
+
+		m.send("docker_container_user_root", prometheus.GaugeValue, boolToFloat(isRootUser(containerJson.Config.User)))
+
+		for _, capability := range hostConfig.CapAdd {
+			m.sendWithLabels("docker_container_capability_added", prometheus.GaugeValue, 1,
+				[]string{"capability"},
+				strings.TrimPrefix(strings.ToUpper(capability), "CAP_"))
+		}
+
+		seccompProfile := "default"
+		for _, opt := range hostConfig.SecurityOpt {
+			if profile, ok := strings.CutPrefix(opt, "seccomp="); ok {
+				seccompProfile = profile
+			} else if profile, ok := strings.CutPrefix(opt, "seccomp:"); ok {
+				seccompProfile = profile
+			}
+		}
+		if hostConfig.Privileged {
+			seccompProfile = "unconfined"
+		}
+		m.sendWithLabels("docker_container_security_info", prometheus.GaugeValue, 1,
+			[]string{"seccomp_profile", "apparmor_profile", "userns_mode"},
+			seccompProfile, containerJson.AppArmorProfile, string(hostConfig.UsernsMode))
+	}
+
+	// Host access
+	if containerJson.HostConfig != nil {
+		for _, device := range containerJson.HostConfig.Devices {
+			m.sendWithLabels("docker_container_host_device_info", prometheus.GaugeValue, 1,
+				[]string{"host_path", "container_path", "permissions"},
+				device.PathOnHost, device.PathInContainer, device.CgroupPermissions)
+		}
+		for _, request := range containerJson.HostConfig.DeviceRequests {
+			count := ""
+			if request.Count < 0 {
+				count = "all"
+			} else if request.Count > 0 {
+				count = strconv.Itoa(request.Count)
+			}
+			capabilities := make([]string, len(request.Capabilities))
+			for i, capability := range request.Capabilities {
+				capabilities[i] = strings.Join(capability, ",")
+			}
+			m.sendWithLabels("docker_container_device_info", prometheus.GaugeValue, 1,
+				[]string{"driver", "device_ids", "count", "capabilities"},
+				request.Driver, strings.Join(request.DeviceIDs, ","), count, strings.Join(capabilities, "|"))
+		}
+	}
+	for _, mount := range containerJson.Mounts {
+		if mount.Type != "bind" || !e.isSensitiveMount(mount.Source) {
+			continue
+		}
+		m.sendWithLabels("docker_container_sensitive_mount_info", prometheus.GaugeValue, 1,
+			[]string{"source", "destination", "rw"},
+			mount.Source, mount.Destination, strconv.FormatBool(mount.RW))
+	}
+
+	// DNS
+	if containerJson.Config != nil && containerJson.HostConfig != nil {
+		m.sendWithLabels("docker_container_dns_info", prometheus.GaugeValue, 1,
+			[]string{"hostname", "domainname", "dns_servers", "dns_search"},
+			containerJson.Config.Hostname, containerJson.Config.Domainname,
+			strings.Join(containerJson.HostConfig.DNS, ","), strings.Join(containerJson.HostConfig.DNSSearch, ","))
+	}
+
+	// Dependencies
+	collectDependencies(m, containerJson)
+
+	// Image update
+	if e.imageChecker != nil {
+		if upToDate, ok := e.imageChecker.upToDate(container.ID); ok {
+			m.send("docker_container_image_up_to_date", prometheus.GaugeValue, boolToFloat(upToDate))
+		}
+	}
+
+	// Writable layer
+	if e.layerSizer != nil {
+		if size, ok := e.layerSizer.size(containerJson); ok {
+			m.send("docker_container_layer_size_bytes", prometheus.GaugeValue, float64(size))
+		}
+	}
+
+	// Filesystem size
+	if e.fsSizer != nil {
+		if size, ok := e.fsSizer.size(container.ID); ok {
+			m.send("docker_container_fs_rw_bytes", prometheus.GaugeValue, float64(size.rw))
+
+			m.send("docker_container_fs_rootfs_bytes", prometheus.GaugeValue, float64(size.rootFs))
+		}
+	}
+
+	// Pauses
+	if e.pauses != nil {
+		m.send("docker_container_paused_seconds_total", prometheus.CounterValue,
+			e.pauses.pausedTime(container.ID, container.State).Seconds())
+	}
+
+	// Start time
+	if startedAt, ok := containerStartedAt(containerJson); ok {
+		m.send("docker_container_start_time_seconds", prometheus.GaugeValue, float64(startedAt.UnixNano())/1e9)
+	}
+
+	// Restarts
+	m.send("docker_container_restarts_total", prometheus.CounterValue, float64(containerJson.RestartCount))
+	if containerJson.State != nil && container.State != "running" && container.State != "paused" {
+		m.send("docker_container_exit_code", prometheus.GaugeValue, float64(containerJson.State.ExitCode))
+	}
+
+	// OOM
+	if containerJson.State != nil {
+		m.send("docker_container_oom_killed", prometheus.GaugeValue, boolToFloat(containerJson.State.OOMKilled))
+	}
+	if e.ooms != nil {
+		m.send("docker_container_oom_events_total", prometheus.CounterValue, float64(e.ooms.count(container.ID)))
+	}
 
 	if container.State != "running" {
 		return nil
 	}
 
-	var stats types.StatsJSON
-	statsReader, err := e.docker.ContainerStatsOneShot(context.TODO(), container.ID)
-	if err != nil {
-		return fmt.Errorf("cannot get stats: %v", err)
+	// cgroup
+	if e.cgroupInfo {
+		cgroupPath, err := e.cgroups.path(ctx, containerJson)
+		if err != nil {
+			return &collectError{reasonOther, fmt.Errorf("cannot resolve cgroup: %v", err)}
+		}
+		driver, _, _ := e.cgroups.detect(ctx)
+		m.sendWithLabels("docker_container_cgroup_info", prometheus.GaugeValue, 1,
+			[]string{"cgroup_path", "cgroup_driver"},
+			cgroupPath, driver)
+	}
+
+	if !opts.wants(statsMetrics...) {
+		return nil
 	}
-	defer statsReader.Body.Close()
-	err = json.NewDecoder(statsReader.Body).Decode(&stats)
+
+	stats, previousStats, err := e.containerStats(ctx, container.ID)
 	if err != nil {
-		return fmt.Errorf("cannot decode stats: %v", err)
+		return err
 	}
+	m.setTimestamp(stats.Read)
+
+	if containerJson.Platform == "windows" {
+		collectWindowsStats(m, stats)
+		return collectProbe(ctx, m, container, containerJson)
+	}
+	e.fillIOStat(ctx, containerJson, stats)
+	e.degradations.observe(container, containerJson, stats)
 
 	// CPU
-	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
-		"docker_container_cpu_seconds_total", "",
-		labelsNames, nil),
-		prometheus.CounterValue,
-		nsToS(stats.CPUStats.CPUUsage.TotalUsage),
-		labelsValues...)
+	m.send("docker_container_cpu_seconds_total", prometheus.CounterValue, nsToS(stats.CPUStats.CPUUsage.TotalUsage))
+
+	m.send("docker_container_cpu_periods_total", prometheus.CounterValue, float64(stats.CPUStats.ThrottlingData.Periods))
+
+	m.send("docker_container_cpu_throttled_periods_total", prometheus.CounterValue, float64(stats.CPUStats.ThrottlingData.ThrottledPeriods))
+
+	m.send("docker_container_cpu_throttled_seconds_total", prometheus.CounterValue, nsToS(stats.CPUStats.ThrottlingData.ThrottledTime))
 
 	// Memory
 	{
-		// https://github.com/docker/docker-ce/blob/6bb4de18c8cdca6916074d7a0be640e27c689202/components/cli/cli/command/container/stats_helpers.go#L227-L249
-		memoryBytes := stats.MemoryStats.Usage
-		cacheKey := "total_inactive_file"
-		if _, isCgroupV1 := stats.MemoryStats.Stats["total_inactive_file"]; !isCgroupV1 {
-			cacheKey = "inactive_file"
-		}
-		if cacheBytes, ok := stats.MemoryStats.Stats[cacheKey]; ok {
-			if memoryBytes < cacheBytes {
-				memoryBytes = 0
-			} else {
-				memoryBytes -= cacheBytes
+		memoryBytes := memoryUsage(stats)
+		_, isCgroupV1 := stats.MemoryStats.Stats["total_inactive_file"]
+
+		m.send("docker_container_memory_usage_bytes", prometheus.GaugeValue, float64(memoryBytes))
+
+		m.send("docker_container_memory_raw_usage_bytes", prometheus.GaugeValue, float64(stats.MemoryStats.Usage))
+
+		if rssBytes, ok := memoryStat(stats, "total_rss", "anon"); ok {
+			m.send("docker_container_memory_rss_bytes", prometheus.GaugeValue, float64(rssBytes))
+		}
+
+		// the limit of containers without a memory limit is the memory of
+		// the host
+		limitConfigured := containerJson.HostConfig != nil && containerJson.HostConfig.Memory > 0
+		limitBytes := float64(stats.MemoryStats.Limit)
+		if !limitConfigured {
+			switch e.unlimitedMemory {
+			case "inf":
+				limitBytes = math.Inf(1)
+			case "zero":
+				limitBytes = 0
 			}
 		}
 
-		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
-			"docker_container_memory_usage_bytes", "",
-			labelsNames, nil),
-			prometheus.GaugeValue,
-			float64(memoryBytes),
-			labelsValues...)
+		m.send("docker_container_memory_limit_bytes", prometheus.GaugeValue, limitBytes)
 
-		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
-			"docker_container_memory_limit_bytes", "",
-			labelsNames, nil),
-			prometheus.GaugeValue,
-			float64(stats.MemoryStats.Limit),
-			labelsValues...)
-	}
+		m.send("docker_container_memory_limit_configured", prometheus.GaugeValue, boolToFloat(limitConfigured))
 
-	// Network
-	{
-		var rxBytes, txBytes uint64
-		for _, network := range stats.Networks {
-			rxBytes += network.RxBytes
-			txBytes += network.TxBytes
+		// cgroup v2 has no failure counter
+		if isCgroupV1 {
+			m.send("docker_container_memory_failures_total", prometheus.CounterValue, float64(stats.MemoryStats.Failcnt))
 		}
 
-		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
-			"docker_container_network_rx_bytes_total", "",
-			labelsNames, nil),
-			prometheus.CounterValue,
-			float64(rxBytes),
-			labelsValues...)
+		for _, stat := range memoryBreakdown {
+			if value, ok := memoryStat(stats, stat.v1Key, stat.v2Key); ok {
+				m.send(stat.name, stat.valueType, float64(value))
+			}
+		}
 
-		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
-			"docker_container_network_tx_bytes_total", "",
-			labelsNames, nil),
-			prometheus.CounterValue,
-			float64(txBytes),
-			labelsValues...)
+		usage.add(container, nsToS(stats.CPUStats.CPUUsage.TotalUsage), float64(memoryBytes))
+		e.top.observe(container, stats, memoryBytes)
 	}
 
+	// Network
+	collectNetwork(m, stats)
+
 	// Block I/O
 	{
-		var readBytes, writeBytes uint64
-		for _, blkioStat := range stats.BlkioStats.IoServiceBytesRecursive {
-			switch blkioStat.Op {
-			case "read":
-				readBytes += blkioStat.Value
-			case "write":
-				writeBytes += blkioStat.Value
-			}
+		if e.deviceNames != nil {
+			e.collectBlkioDevices(m, stats)
+		} else {
+			readBytes, writeBytes := blkioBytes(stats)
+
+			m.send("docker_container_blkio_read_bytes_total", prometheus.CounterValue, float64(readBytes))
+
+			m.send("docker_container_blkio_write_bytes_total", prometheus.CounterValue, float64(writeBytes))
+
+			reads, _ := blkioOp(stats.BlkioStats.IoServicedRecursive, "read")
+			writes, _ := blkioOp(stats.BlkioStats.IoServicedRecursive, "write")
+
+			m.send("docker_container_blkio_reads_total", prometheus.CounterValue, float64(reads))
+
+			m.send("docker_container_blkio_writes_total", prometheus.CounterValue, float64(writes))
 		}
 
-		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
-			"docker_container_blkio_read_bytes_total", "",
-			labelsNames, nil),
-			prometheus.CounterValue,
-			float64(readBytes),
-			labelsValues...)
+		if discardBytes, ok := blkioOp(stats.BlkioStats.IoServiceBytesRecursive, "discard"); ok {
+			m.send("docker_container_blkio_discard_bytes_total", prometheus.CounterValue, float64(discardBytes))
+		}
+		if discards, ok := blkioOp(stats.BlkioStats.IoServicedRecursive, "discard"); ok {
+			m.send("docker_container_blkio_discards_total", prometheus.CounterValue, float64(discards))
+		}
 
-		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
-			"docker_container_blkio_write_bytes_total", "",
-			labelsNames, nil),
-			prometheus.CounterValue,
-			float64(writeBytes),
-			labelsValues...)
+		if e.blkioOps {
+			for _, op := range blkioOps {
+				if opBytes, ok := blkioOp(stats.BlkioStats.IoServiceBytesRecursive, op); ok {
+					m.sendWithLabels("docker_container_blkio_bytes_total", prometheus.CounterValue, float64(opBytes),
+						[]string{"op"},
+						op)
+				}
+				if ios, ok := blkioOp(stats.BlkioStats.IoServicedRecursive, op); ok {
+					m.sendWithLabels("docker_container_blkio_ios_total", prometheus.CounterValue, float64(ios),
+						[]string{"op"},
+						op)
+				}
+			}
+		}
 	}
 
 	// PIDs
-	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
-		"docker_container_pids", "",
-		labelsNames, nil),
-		prometheus.GaugeValue,
-		float64(stats.PidsStats.Current),
-		labelsValues...)
+	m.send("docker_container_pids", prometheus.GaugeValue, float64(stats.PidsStats.Current))
+
+	// the limit of containers without a PIDs limit is 0
+	if stats.PidsStats.Limit > 0 {
+		m.send("docker_container_pids_limit", prometheus.GaugeValue, float64(stats.PidsStats.Limit))
+	}
+
+	if previousStats != nil {
+		collectRates(m, stats, previousStats)
+	}
+
+	if e.networkInterfaces && containerJson.State != nil {
+		if err := collectNetworkInterfaces(m, e.procPath, containerJson.State.Pid); err != nil {
+			return err
+		}
+	}
+
+	// the IP statistics of containers sharing the network namespace of the
+	// host are the ones of the host
+	if e.networkFamilies && containerJson.State != nil && containerJson.HostConfig != nil && !containerJson.HostConfig.NetworkMode.IsHost() {
+		if err := collectNetworkFamilies(m, e.procPath, containerJson.State.Pid); err != nil {
+			return err
+		}
+	}
+
+	if e.cpuMax {
+		if err := e.collectCPUMax(ctx, m, containerJson); err != nil {
+			return err
+		}
+	}
+
+	if e.processMetrics {
+		if err := e.collectProcesses(ctx, m, containerJson); err != nil {
+			return err
+		}
+	}
+
+	// the conntrack table of containers sharing the network namespace of
+	// the host is the one of the host
+	if e.conntrack && containerJson.State != nil && containerJson.HostConfig != nil && !containerJson.HostConfig.NetworkMode.IsHost() {
+		if err := collectConntrack(m, e.procPath, containerJson.State.Pid); err != nil {
+			return err
+		}
+	}
+
+	return collectProbe(ctx, m, container, containerJson)
+}
+
+// inShard reports whether a container belongs to the shard of containers
+// collected by this exporter instance.
+func (e *exporter) inShard(containerID string) bool {
+	if e.shardTotal <= 1 {
+		return true
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(containerID))
+	return hash.Sum32()%e.shardTotal == e.shardIndex
+}
+
+// exclusionReason returns why a container is excluded from collection, or an
+// empty string for containers to collect.
+func (e *exporter) exclusionReason(container *types.Container) string {
+	if !e.inShard(container.ID) {
+		return "shard"
+	}
+	if e.balenaExclude && isBalenaSupervisor(containerName(container), container) {
+		return "balena_supervisor"
+	}
+	if e.selfContainer == "exclude" && e.isSelf(container.ID) {
+		return "self"
+	}
+	return ""
+}
+
+// labels returns the names and values of the labels of all metrics of a
+// container.
+func (e *exporter) labels(container *types.Container, containerJson types.ContainerJSON, errs *templateErrors) ([]string, []string) {
+	size := 2 + len(e.extraLabels) + len(nomadLabelNames) + len(balenaLabelNames)
+	labelsNames := make([]string, 1, size)
+	labelsValues := make([]string, 1, size)
+	name := containerName(container)
+	labelsNames[0] = "name"
+	labelsValues[0] = name
+	// the name is kept so that containers with the same normalized name,
+	// such as the replicas of a service, do not export duplicate series
+	if e.nameNormalize != nil {
+		labelsNames = append(labelsNames, normalizedNameLabel)
+		labelsValues = append(labelsValues, e.nameNormalize.ReplaceAllString(name, ""))
+	}
+
+	values, labelErrs := e.labelLimits.values(e.extraLabels, container, containerJson)
+	for i, label := range e.extraLabels {
+		value := values[i]
+		if labelErrs[i] != nil {
+			errs.add(label.name, container, labelErrs[i])
+		}
+		if e.labelGuard != nil {
+			value = e.labelGuard.value(label.name, value)
+		}
+		labelsNames = append(labelsNames, label.name)
+		labelsValues = append(labelsValues, value)
+	}
+	if e.nomadLabels {
+		labelsNames = append(labelsNames, nomadLabelNames...)
+		labelsValues = append(labelsValues, nomadLabels(name, containerJson)...)
+	}
+	if e.balenaLabels {
+		labelsNames = append(labelsNames, balenaLabelNames...)
+		labelsValues = append(labelsValues, balenaLabels(name, container)...)
+	}
+	return labelsNames, labelsValues
+}
+
+// containerStartedAt returns the time a container last started, if it ever
+// started.
+func containerStartedAt(containerJson types.ContainerJSON) (time.Time, bool) {
+	if containerJson.State == nil {
+		return time.Time{}, false
+	}
+	// containers never started have a zero start time
+	startedAt, err := time.Parse(time.RFC3339Nano, containerJson.State.StartedAt)
+	if err != nil || startedAt.Year() <= 1 {
+		return time.Time{}, false
+	}
+	return startedAt, true
+}
+
+// containerStartTime returns the time a container last started, or the time
+// it was created if it never started.
+func containerStartTime(container *types.Container, containerJson types.ContainerJSON) time.Time {
+	if startedAt, ok := containerStartedAt(containerJson); ok {
+		return startedAt
+	}
+	return time.Unix(container.Created, 0)
+}
+
+// memoryUsage returns the memory usage of a container, excluding the
+// inactive page cache, like the Docker CLI.
+func memoryUsage(stats *types.StatsJSON) uint64 {
+	// https://github.com/docker/docker-ce/blob/6bb4de18c8cdca6916074d7a0be640e27c689202/components/cli/cli/command/container/stats_helpers.go#L227-L249
+	memoryBytes := stats.MemoryStats.Usage
+	cacheKey := "total_inactive_file"
+	if _, isCgroupV1 := stats.MemoryStats.Stats["total_inactive_file"]; !isCgroupV1 {
+		cacheKey = "inactive_file"
+	}
+	if cacheBytes, ok := stats.MemoryStats.Stats[cacheKey]; ok {
+		if memoryBytes < cacheBytes {
+			return 0
+		}
+		memoryBytes -= cacheBytes
+	}
+	return memoryBytes
+}
+
+// containerNames caches the names of containers by ID, since the name of a
+// container is looked up many times per collection.
+var containerNames = &nameCache{byID: make(map[string]cachedName)}
+
+// nameCache is a cache of the names of containers, invalidated when they are
+// renamed.
+type nameCache struct {
+	mu   sync.RWMutex
+	byID map[string]cachedName
+}
+
+type cachedName struct {
+	raw  string
+	name string
+}
+
+// retain removes the names of containers not in containers.
+func (c *nameCache) retain(containers []types.Container) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	listed := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		listed[container.ID] = true
+	}
+	for id := range c.byID {
+		if !listed[id] {
+			delete(c.byID, id)
+		}
+	}
+}
+
+func containerName(container *types.Container) string {
+	raw := container.Names[0]
+	containerNames.mu.RLock()
+	cached, ok := containerNames.byID[container.ID]
+	containerNames.mu.RUnlock()
+	if ok && cached.raw == raw {
+		return cached.name
+	}
+	name := strings.Trim(raw, "/")
+	containerNames.mu.Lock()
+	containerNames.byID[container.ID] = cachedName{raw, name}
+	containerNames.mu.Unlock()
+	return name
+}
+
+// shortID returns the ID of a container truncated like by the Docker CLI.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+func hasLabel(labelsNames []string, name string) bool {
+	for _, labelName := range labelsNames {
+		if labelName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sortContainers sorts containers by name and ID, so that they are collected
+// and listed in the same order regardless of the order of the daemon.
+func sortContainers(containers []types.Container) {
+	sort.Slice(containers, func(i, j int) bool {
+		if nameI, nameJ := containerName(&containers[i]), containerName(&containers[j]); nameI != nameJ {
+			return nameI < nameJ
+		}
+		return containers[i].ID < containers[j].ID
+	})
+}
+
+// isSensitiveMount reports whether source is one of the sensitive host paths
+// or, except for the root directory, a path below one of them.
+func (e *exporter) isSensitiveMount(source string) bool {
+	for _, path := range e.sensitiveMounts {
+		if source == path || (path != "/" && strings.HasPrefix(source, path+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *exporter) formatHealthOutput(output string) string {
+	output = strings.TrimSpace(output)
+	switch e.healthOutput {
+	case "hash":
+		sum := sha256.Sum256([]byte(output))
+		return hex.EncodeToString(sum[:4])
+	default:
+		output, _, _ = strings.Cut(output, "\n")
+		if runes := []rune(output); len(runes) > healthOutputMaxLength {
+			output = string(runes[:healthOutputMaxLength])
+		}
+		return output
+	}
+}
+
+// cpusetSize returns the number of CPUs in a cpuset list such as "0-3,8".
+func cpusetSize(cpuset string) (int, error) {
+	size := 0
+	for _, part := range strings.Split(cpuset, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			return 0, err
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(last)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if end < start {
+			return 0, fmt.Errorf("invalid range %q", part)
+		}
+		size += end - start + 1
+	}
+	return size, nil
+}
 
-	return nil
+// tmpfsSize returns the size in bytes set in tmpfs mount options such as
+// "rw,size=64m". Sizes relative to the host memory are not supported.
+func tmpfsSize(options string) (int64, bool) {
+	for _, option := range strings.Split(options, ",") {
+		if value, ok := strings.CutPrefix(option, "size="); ok {
+			size, err := units.RAMInBytes(value)
+			return size, err == nil
+		}
+	}
+	return 0, false
+}
+
+// isRootUser reports whether a container configured with the given user
+// (in the "user[:group]" format) runs as root.
+func isRootUser(user string) bool {
+	user, _, _ = strings.Cut(user, ":")
+	return user == "" || user == "root" || user == "0"
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
 }
 
 func nsToS(ns uint64) float64 {
 	return float64(ns) / float64(time.Second)
 }
 
-func main() {
-	extraLabels := make(map[string]*template.Template)
+// listenAddrs returns the addresses to serve metrics on over plain HTTP.
+func listenAddrs() []string {
+	if getenv("ADDR") == "" {
+		// TLS-only unless plain HTTP is also requested
+		if getenv("TLS_ADDR") != "" {
+			return nil
+		}
+		return []string{":9338"}
+	}
+	addrs := []string{}
+	for _, addr := range strings.Split(getenv("ADDR"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+func newExporterFromEnv() *exporter {
+	// modes set variables explicitly, so that profiles do not override them
+	if getenv("CARDINALITY") != "" {
+		if err := applyCardinality(getenv("CARDINALITY")); err != nil {
+			fatal(configError("invalid CARDINALITY %q: %v", getenv("CARDINALITY"), err))
+		}
+	}
+	if getenv("PROFILE") != "" {
+		if err := applyProfile(getenv("PROFILE")); err != nil {
+			fatal(configError("invalid PROFILE %q: %v", getenv("PROFILE"), err))
+		}
+	}
+
+	extraLabels := []labelTemplate{}
 	envPrefix := "LABEL_"
 	for _, env := range os.Environ() {
 		name, value, _ := strings.Cut(env, "=")
@@ -216,34 +1086,472 @@ func main() {
 			label := strings.TrimPrefix(name, envPrefix)
 			tmpl, err := template.New(label).Parse(value)
 			if err != nil {
-				log.Fatalf("invalid template for label %s: %v", label, err)
+				fatal(configError("invalid template for label %s: %v", label, err))
 			}
-			extraLabels[label] = tmpl
+			extraLabels = append(extraLabels, labelTemplate{label, tmpl})
+		}
+	}
+	fallbackPrefix := "FALLBACK_LABEL_"
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, fallbackPrefix) {
+			label := strings.TrimPrefix(name, fallbackPrefix)
+			if _, ok := os.LookupEnv(envPrefix + label); ok {
+				fatal(configError("label %s is defined by both %s%s and %s%s", label, envPrefix, label, fallbackPrefix, label))
+			}
+			text, err := fallbackTemplate(value)
+			if err != nil {
+				fatal(configError("invalid fallback chain for label %s: %v", label, err))
+			}
+			extraLabels = append(extraLabels, labelTemplate{label, template.Must(template.New(label).Parse(text))})
+		}
+	}
+	sort.Slice(extraLabels, func(i, j int) bool { return extraLabels[i].name < extraLabels[j].name })
+	for _, label := range extraLabels {
+		if metric, ok := metricLabelNames[label.name]; ok {
+			fatal(configError("label %s is already a label of the metric %s", label.name, metric))
 		}
 	}
 
-	addr := ":9338"
-	if os.Getenv("ADDR") != "" {
-		addr = os.Getenv("ADDR")
+	var nameNormalize *regexp.Regexp
+	if getenv("NAME_NORMALIZE") != "" {
+		var err error
+		nameNormalize, err = regexp.Compile(getenv("NAME_NORMALIZE"))
+		if err != nil {
+			fatal(configError("invalid NAME_NORMALIZE: %v", err))
+		}
 	}
 
-	docker, err := client.NewClientWithOpts(
-		client.FromEnv,
-		client.WithAPIVersionNegotiation(),
-	)
+	healthOutput := getenv("HEALTH_OUTPUT")
+	switch healthOutput {
+	case "", "hash", "truncate":
+	default:
+		fatal(configError("invalid HEALTH_OUTPUT %q: must be hash or truncate", healthOutput))
+	}
+
+	unlimitedMemory := getenv("UNLIMITED_MEMORY_LIMIT")
+	switch unlimitedMemory {
+	case "", "host", "inf", "zero":
+	default:
+		fatal(configError("invalid UNLIMITED_MEMORY_LIMIT %q: must be host, inf, or zero", unlimitedMemory))
+	}
+
+	metricsSubsets, err := parseMetricsSubsets(os.Environ())
 	if err != nil {
-		log.Fatalf("cannot create docker client: %v", err)
-		return
+		fatal(configError("invalid metrics paths: %v", err))
 	}
 
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(&exporter{
-		docker:      docker,
-		extraLabels: extraLabels,
-	})
-	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	http.Handle("/metrics", handler)
+	historySamples := 0
+	if getenv("HISTORY_SAMPLES") != "" {
+		historySamples, err = strconv.Atoi(getenv("HISTORY_SAMPLES"))
+		if err != nil || historySamples <= 0 {
+			fatal(configError("invalid HISTORY_SAMPLES %q: must be a positive integer", getenv("HISTORY_SAMPLES")))
+		}
+	}
+	historyInterval := defaultHistoryInterval
+	if getenv("HISTORY_INTERVAL") != "" {
+		historyInterval, err = time.ParseDuration(getenv("HISTORY_INTERVAL"))
+		if err != nil || historyInterval <= 0 {
+			fatal(configError("invalid HISTORY_INTERVAL %q: must be a positive duration", getenv("HISTORY_INTERVAL")))
+		}
+	}
+
+	groups, err := parseGroups(os.Environ())
+	if err != nil {
+		fatal(configError("invalid groups: %v", err))
+	}
+
+	commandInfo := getenv("COMMAND_INFO")
+	switch commandInfo {
+	case "", "hash", "truncate":
+	default:
+		fatal(configError("invalid COMMAND_INFO %q: must be hash or truncate", commandInfo))
+	}
+
+	var envHashVars []string
+	if getenv("ENV_HASH_VARS") != "" {
+		for _, name := range strings.Split(getenv("ENV_HASH_VARS"), ",") {
+			envHashVars = append(envHashVars, strings.TrimSpace(name))
+		}
+		sort.Strings(envHashVars)
+	}
+
+	sensitiveMounts := defaultSensitiveMounts
+	if getenv("SENSITIVE_MOUNTS") != "" {
+		sensitiveMounts = nil
+		for _, path := range strings.Split(getenv("SENSITIVE_MOUNTS"), ",") {
+			sensitiveMounts = append(sensitiveMounts, filepath.Clean(strings.TrimSpace(path)))
+		}
+	}
+
+	var shardIndex, shardTotal uint64
+	if getenv("SHARD_TOTAL") != "" {
+		var err error
+		shardTotal, err = strconv.ParseUint(getenv("SHARD_TOTAL"), 10, 32)
+		if err != nil || shardTotal == 0 {
+			fatal(configError("invalid SHARD_TOTAL %q: must be a positive integer", getenv("SHARD_TOTAL")))
+		}
+		shardIndex, err = strconv.ParseUint(getenv("SHARD_INDEX"), 10, 32)
+		if err != nil || shardIndex >= shardTotal {
+			fatal(configError("invalid SHARD_INDEX %q: must be an integer between 0 and %d", getenv("SHARD_INDEX"), shardTotal-1))
+		}
+	}
+
+	var labelGuard *cardinalityGuard
+	if getenv("MAX_LABEL_VALUES") != "" {
+		maxValues, err := strconv.Atoi(getenv("MAX_LABEL_VALUES"))
+		if err != nil || maxValues <= 0 {
+			fatal(configError("invalid MAX_LABEL_VALUES %q: must be a positive integer", getenv("MAX_LABEL_VALUES")))
+		}
+		labelGuard = newCardinalityGuard(maxValues)
+	}
+
+	labelMaxLength := defaultLabelMaxLength
+	if getenv("MAX_LABEL_LENGTH") != "" {
+		labelMaxLength, err = strconv.Atoi(getenv("MAX_LABEL_LENGTH"))
+		if err != nil || labelMaxLength <= 0 {
+			fatal(configError("invalid MAX_LABEL_LENGTH %q: must be a positive integer", getenv("MAX_LABEL_LENGTH")))
+		}
+	}
+	templateTimeout := defaultTemplateTimeout
+	if getenv("TEMPLATE_TIMEOUT") != "" {
+		templateTimeout, err = time.ParseDuration(getenv("TEMPLATE_TIMEOUT"))
+		if err != nil || templateTimeout <= 0 {
+			fatal(configError("invalid TEMPLATE_TIMEOUT %q: must be a positive duration", getenv("TEMPLATE_TIMEOUT")))
+		}
+	}
+
+	statsMode := statsModeOneShot
+	if getenv("STATS_MODE") != "" {
+		statsMode = getenv("STATS_MODE")
+	}
+	switch statsMode {
+	case statsModeOneShot, statsModeTwoSample, statsModePrevious:
+	default:
+		fatal(configError("invalid STATS_MODE %q: must be %s, %s, or %s", statsMode, statsModeOneShot, statsModeTwoSample, statsModePrevious))
+	}
+
+	concurrency := defaultConcurrency
+	if getenv("CONCURRENCY") != "" {
+		var err error
+		concurrency, err = strconv.Atoi(getenv("CONCURRENCY"))
+		if err != nil || concurrency <= 0 {
+			fatal(configError("invalid CONCURRENCY %q: must be a positive integer", getenv("CONCURRENCY")))
+		}
+	}
+
+	procPath := "/proc"
+	if getenv("HOST_PROC") != "" {
+		procPath = getenv("HOST_PROC")
+	}
+
+	var collectors []prometheus.Collector
+	if getenv("HOST_METRICS") == "true" {
+		rootPath := "/"
+		if getenv("HOST_ROOT") != "" {
+			rootPath = getenv("HOST_ROOT")
+		}
+		hostCollector, err := newHostCollector(procPath, rootPath)
+		if err != nil {
+			fatal(configError("cannot create host collector: %v", err))
+		}
+		collectors = append(collectors, hostCollector)
+	}
+	if getenv("GO_METRICS") == "true" {
+		collectors = append(collectors, runtimeCollectors()...)
+	}
+
+	var deviceNames *deviceNames
+	if getenv("BLKIO_PER_DEVICE") == "true" {
+		deviceNames = newDeviceNames(procPath)
+	}
+
+	var layerSizer *layerSizer
+	if getenv("LAYER_SIZE_INTERVAL") != "" {
+		interval, err := time.ParseDuration(getenv("LAYER_SIZE_INTERVAL"))
+		if err != nil || interval <= 0 {
+			fatal(configError("invalid LAYER_SIZE_INTERVAL %q: must be a positive duration", getenv("LAYER_SIZE_INTERVAL")))
+		}
+		rootPath := "/"
+		if getenv("HOST_ROOT") != "" {
+			rootPath = getenv("HOST_ROOT")
+		}
+		layerSizer = newLayerSizer(rootPath, interval)
+	}
+
+	var gatherers []prometheus.Gatherer
+	if getenv("ENGINE_METRICS_URL") != "" {
+		gatherers = append(gatherers, newEngineMetrics(getenv("ENGINE_METRICS_URL")))
+	}
+
+	var containerTimeout time.Duration
+	var dockerConfig dockerClientConfig
+	for _, duration := range []struct {
+		env   string
+		value *time.Duration
+	}{
+		{"DOCKER_TIMEOUT", &containerTimeout},
+		{"DOCKER_DIAL_TIMEOUT", &dockerConfig.dialTimeout},
+		{"DOCKER_KEEPALIVE", &dockerConfig.keepAlive},
+		{"DOCKER_IDLE_CONN_TIMEOUT", &dockerConfig.idleConnTimeout},
+	} {
+		if getenv(duration.env) != "" {
+			value, err := time.ParseDuration(getenv(duration.env))
+			if err != nil || value <= 0 {
+				fatal(configError("invalid %s %q: must be a positive duration", duration.env, getenv(duration.env)))
+			}
+			*duration.value = value
+		}
+	}
+	if getenv("DOCKER_MAX_IDLE_CONNS") != "" {
+		dockerConfig.maxIdleConns, err = strconv.Atoi(getenv("DOCKER_MAX_IDLE_CONNS"))
+		if err != nil || dockerConfig.maxIdleConns <= 0 {
+			fatal(configError("invalid DOCKER_MAX_IDLE_CONNS %q: must be a positive integer", getenv("DOCKER_MAX_IDLE_CONNS")))
+		}
+	}
+
+	if getenv("DOCKER_HOST_FALLBACK") != "" {
+		dockerConfig.fallbackHosts = strings.Split(getenv("DOCKER_HOST_FALLBACK"), ",")
+	}
+
+	var docker *client.Client
+	var transport *dockerTransport
+	if getenv("MOCK_FIXTURES") != "" {
+		docker, transport, err = newMockDockerClient(getenv("MOCK_FIXTURES"))
+	} else {
+		docker, transport, err = newDockerClient(dockerConfig)
+	}
+	if err != nil {
+		fatal(configError("cannot create docker client: %v", err))
+	}
+	// AUDIT_LOG is not read with getenv, as AUDIT_LOG_FILE is the path of
+	// the audit log rather than a file holding its value
+	if os.Getenv("AUDIT_LOG") == "true" || getenv("AUDIT_LOG_FILE") != "" {
+		audit, err := newAuditTransport(transport.RoundTripper, getenv("AUDIT_LOG_FILE"))
+		if err != nil {
+			fatal(configError("cannot open AUDIT_LOG_FILE: %v", err))
+		}
+		transport.RoundTripper = audit
+	}
+
+	var imageChecker *imageChecker
+	if getenv("IMAGE_CHECK_INTERVAL") != "" {
+		interval, err := time.ParseDuration(getenv("IMAGE_CHECK_INTERVAL"))
+		if err != nil || interval <= 0 {
+			fatal(configError("invalid IMAGE_CHECK_INTERVAL %q: must be a positive duration", getenv("IMAGE_CHECK_INTERVAL")))
+		}
+		timeout := defaultRegistryTimeout
+		if getenv("REGISTRY_TIMEOUT") != "" {
+			timeout, err = time.ParseDuration(getenv("REGISTRY_TIMEOUT"))
+			if err != nil || timeout <= 0 {
+				fatal(configError("invalid REGISTRY_TIMEOUT %q: must be a positive duration", getenv("REGISTRY_TIMEOUT")))
+			}
+		}
+		imageChecker, err = newImageChecker(docker, interval, timeout, getenv("REGISTRY_AUTH"))
+		if err != nil {
+			fatal(configError("cannot create image checker: %v", err))
+		}
+	}
+
+	var fsSizer *fsSizer
+	if getenv("FS_SIZE_INTERVAL") != "" {
+		interval, err := time.ParseDuration(getenv("FS_SIZE_INTERVAL"))
+		if err != nil || interval <= 0 {
+			fatal(configError("invalid FS_SIZE_INTERVAL %q: must be a positive duration", getenv("FS_SIZE_INTERVAL")))
+		}
+		fsSizer = newFSSizer(docker, interval)
+	}
+
+	if getenv("IMAGE_METRICS") == "true" {
+		collectors = append(collectors, &imageCollector{docker})
+	}
+
+	cgroupRoot := "/sys/fs/cgroup"
+	if getenv("HOST_CGROUP") != "" {
+		cgroupRoot = getenv("HOST_CGROUP")
+	}
+
+	events := &eventWatcher{docker: docker}
+	inspectCache := newInspectCache()
+	events.handle(inspectCache.handleEvent)
+	samples := newSampleCache()
+	events.handle(samples.handleEvent)
+	if getenv("LIFETIME_METRICS") == "true" {
+		lifetimeTracker := newLifetimeTracker(docker)
+		events.handle(lifetimeTracker.handleEvent)
+		collectors = append(collectors, lifetimeTracker.histogram)
+	}
+	var pauseTracker *pauseTracker
+	if getenv("PAUSE_METRICS") == "true" {
+		pauseTracker = newPauseTracker()
+		events.handle(pauseTracker.handleEvent)
+	}
+	selfContainer := getenv("SELF_CONTAINER")
+	var selfID string
+	switch selfContainer {
+	case "":
+	case "exclude", "label":
+		selfID = selfContainerID()
+		if selfID == "" {
+			log.Printf("cannot find the container of the exporter for SELF_CONTAINER")
+		}
+	default:
+		fatal(configError("invalid SELF_CONTAINER %q: must be exclude or label", selfContainer))
+	}
+
+	var counterResets *counterResets
+	if getenv("CUMULATIVE_COUNTERS") == "true" {
+		counterResets = newCounterResets()
+	}
+
+	var oomTracker *oomTracker
+	if getenv("OOM_METRICS") == "true" {
+		oomTracker = newOOMTracker()
+		events.handle(oomTracker.handleEvent)
+	}
+	if getenv("BUILDER_METRICS") == "true" {
+		builderTracker := newBuilderTracker()
+		events.handle(builderTracker.handleEvent)
+		collectors = append(collectors, builderTracker.collectors()...)
+	}
+
+	e := &exporter{
+		docker:            docker,
+		transport:         transport,
+		extraLabels:       extraLabels,
+		nameNormalize:     nameNormalize,
+		healthOutput:      healthOutput,
+		unlimitedMemory:   unlimitedMemory,
+		commandInfo:       commandInfo,
+		envHashVars:       envHashVars,
+		envHashKey:        []byte(getenv("ENV_HASH_KEY")),
+		groups:            groups,
+		groupCPU:          newGroupCPU(groups),
+		sensitiveMounts:   sensitiveMounts,
+		imageChecker:      imageChecker,
+		shardIndex:        uint32(shardIndex),
+		shardTotal:        uint32(shardTotal),
+		labelGuard:        labelGuard,
+		labelLimits:       newLabelLimits(labelMaxLength, templateTimeout),
+		targets:           newTargetList(),
+		top:               newTopList(),
+		endpoints:         newEndpointList(),
+		metricsSubsets:    metricsSubsets,
+		sampleTimestamps:  getenv("SAMPLE_TIMESTAMPS") == "true",
+		counterResets:     counterResets,
+		degradations:      newDegradations(),
+		containerTimeout:  containerTimeout,
+		inspectCache:      inspectCache,
+		samples:           samples,
+		cgroups:           newCgroups(docker, cgroupRoot, procPath),
+		cgroupInfo:        getenv("CGROUP_INFO") == "true",
+		deviceNames:       deviceNames,
+		cgroupLabel:       getenv("CGROUP_LABEL") == "true",
+		infoLabels:        getenv("INFO_LABELS") != "false",
+		pauses:            pauseTracker,
+		ooms:              oomTracker,
+		layerSizer:        layerSizer,
+		fsSizer:           fsSizer,
+		collectors:        collectors,
+		gatherers:         gatherers,
+		events:            events,
+		statsMode:         statsMode,
+		statsHistory:      newStatsHistory(),
+		blkioOps:          getenv("BLKIO_OPS") == "true",
+		procPath:          procPath,
+		networkInterfaces: getenv("NETWORK_INTERFACES") == "true",
+		networkPerIface:   getenv("NETWORK_PER_INTERFACE") == "true",
+		networkFamilies:   getenv("NETWORK_FAMILIES") == "true",
+		conntrack:         getenv("CONNTRACK_METRICS") == "true",
+		processMetrics:    getenv("PROCESS_METRICS") == "true",
+		cpuMax:            getenv("CPU_MAX") == "true",
+		concurrency:       concurrency,
+		nomadLabels:       getenv("NOMAD_LABELS") == "true",
+		balenaLabels:      getenv("BALENA_LABELS") == "true",
+		balenaExclude:     getenv("BALENA_EXCLUDE_SUPERVISOR") == "true",
+		selfContainer:     selfContainer,
+		selfID:            selfID,
+	}
+	if historySamples > 0 {
+		e.history = newHistoryList(docker, historySamples, historyInterval, func(container *types.Container) bool {
+			return e.exclusionReason(container) != ""
+		})
+	}
+	return e
+}
+
+func main() {
+	exporter := newExporterFromEnv()
+	prometheus.NewRegistry().MustRegister(exporter)
+
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(exporter, os.Args[1], os.Args[2:]))
+	}
+
+	ping, err := exporter.docker.Ping(context.Background())
+	if err != nil {
+		fatal(dockerError("cannot connect to the Docker daemon: %v", err))
+	}
+	exporter.docker.NegotiateAPIVersionPing(ping)
+
+	if exporter.imageChecker != nil {
+		go exporter.imageChecker.run()
+	}
+	if exporter.history != nil {
+		go exporter.history.run()
+	}
+	// the events invalidate the inspect and sample caches, which are always
+	// in use
+	go exporter.events.run()
+	if getenv("WARM_UP") != "false" {
+		go exporter.warmUp()
+	}
+
+	http.Handle("/metrics", newMetricsHandler(exporter))
+	for _, subset := range exporter.metricsSubsets {
+		http.Handle("/metrics/"+subset.name, newMetricsSubsetHandler(exporter, subset))
+	}
+	http.Handle("/containers/", newContainerMetricsHandler(exporter))
+	http.Handle("/targets", newTargetsHandler(exporter.targets))
+	http.Handle("/top", newTopHandler(exporter.top))
+	if exporter.history != nil {
+		http.Handle("/history", newHistoryHandler(exporter.history))
+	}
+	if getenv("DEBUG_ENDPOINTS") == "true" {
+		http.Handle("/debug/container/", newDebugStatsHandler(exporter))
+	}
 	http.Handle("/", http.RedirectHandler("/metrics", http.StatusMovedPermanently))
-	fmt.Printf("Listening on http://%s...\n", addr)
-	log.Fatal(http.ListenAndServe(addr, nil))
+
+	configs, err := listenConfigs()
+	if err != nil {
+		fatal(configError("%v", err))
+	}
+	listeners := []net.Listener{}
+	for _, config := range configs {
+		listener, err := config.listen()
+		if err != nil {
+			fatal(listenError("cannot listen on %s: %v", config.addr, err))
+		}
+		listeners = append(listeners, listener)
+	}
+
+	if getenv("RUN_AS_USER") != "" {
+		var groups []string
+		if getenv("RUN_AS_GROUPS") != "" {
+			groups = strings.Split(getenv("RUN_AS_GROUPS"), ",")
+		}
+		socketPath, _ := strings.CutPrefix(exporter.docker.DaemonHost(), "unix://")
+		if socketPath == exporter.docker.DaemonHost() {
+			socketPath = ""
+		}
+		err := dropPrivileges(getenv("RUN_AS_USER"), getenv("RUN_AS_GROUP"), groups, socketPath)
+		if err != nil {
+			fatal(configError("cannot drop privileges: %v", err))
+		}
+	}
+
+	for _, config := range configs {
+		fmt.Printf("Listening on %s...\n", config)
+	}
+	fatal(listenError("cannot serve HTTP: %v", serveListeners(listeners, nil)))
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scrapeMock scrapes an exporter of the mock fixtures configured from the
+// environment, set with t.Setenv before, returning the metrics in the text
+// format.
+func scrapeMock(t *testing.T) string {
+	t.Helper()
+	t.Setenv("MOCK_FIXTURES", "fixtures")
+	server := httptest.NewServer(newMetricsHandler(newExporterFromEnv()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("cannot scrape exporter: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("cannot read metrics: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("scrape failed with status %d: %s", resp.StatusCode, body)
+	}
+	return string(body)
+}
+
+func TestNameNormalizeDistinctSeries(t *testing.T) {
+	// both containers of the fixtures normalize to the same name
+	t.Setenv("NAME_NORMALIZE", ".*")
+
+	metrics := scrapeMock(t)
+	for _, series := range []string{
+		`docker_container_info{id="aaa111",image="nginx:latest",image_id="sha256:abc",name="nginx",normalized_name=""} 1`,
+		`docker_container_info{id="bbb222",image="redis",image_id="sha256:def",name="redis",normalized_name=""} 1`,
+	} {
+		if !strings.Contains(metrics, series) {
+			t.Errorf("series %s missing", series)
+		}
+	}
+}
+
+func BenchmarkCollect(b *testing.B) {
+	b.Setenv("MOCK_FIXTURES", "fixtures")
+	e := newExporterFromEnv()
+	ch := make(chan prometheus.Metric)
+	go func() {
+		for range ch {
+		}
+	}()
+	defer close(ch)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.collect(context.Background(), ch, collectOptions{})
+	}
+}
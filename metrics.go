@@ -0,0 +1,189 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// containerMetrics sends the metrics of a container. Descriptors are shared
+// across containers and label pairs across the metrics of a container,
+// avoiding most of the allocations of prometheus.MustNewConstMetric.
+type containerMetrics struct {
+	e            *exporter
+	ch           chan<- prometheus.Metric
+	containerID  string
+	labelsNames  []string
+	labelsValues []string
+	labelPairs   []*dto.LabelPair
+	// timestampMs is the timestamp of the metrics, if not nil
+	timestampMs *int64
+	// startTime is the start of the container, the start of its counters
+	// when cumulative counters are enabled
+	startTime time.Time
+}
+
+func (e *exporter) newContainerMetrics(ch chan<- prometheus.Metric, containerID string, labelsNames, labelsValues []string) *containerMetrics {
+	m := &containerMetrics{
+		e:            e,
+		ch:           ch,
+		containerID:  containerID,
+		labelsNames:  labelsNames,
+		labelsValues: labelsValues,
+		labelPairs:   makeLabelPairs(labelsNames, labelsValues),
+	}
+	if e.sampleTimestamps {
+		m.setTimestamp(time.Now())
+	}
+	return m
+}
+
+// setTimestamp sets the timestamp of the metrics sent next, when sample
+// timestamps are enabled.
+func (m *containerMetrics) setTimestamp(t time.Time) {
+	if m.e.sampleTimestamps && !t.IsZero() {
+		timestampMs := t.UnixMilli()
+		m.timestampMs = &timestampMs
+	}
+}
+
+// send sends a metric with the labels of the container.
+func (m *containerMetrics) send(name string, valueType prometheus.ValueType, value float64) {
+	if valueType == prometheus.CounterValue && m.e.counterResets != nil {
+		var start time.Time
+		value, start = m.e.counterResets.adjust(m.containerID, name, nil, value, m.startTime)
+		m.sendCreated(name, m.labelsNames, m.labelPairs, start)
+	}
+	m.ch <- &constMetric{
+		desc:        m.e.desc(name, m.labelsNames),
+		valueType:   valueType,
+		value:       value,
+		labelPairs:  m.labelPairs,
+		timestampMs: m.timestampMs,
+	}
+}
+
+// metricLabelNames are the additional labels of metrics sent with
+// sendWithLabels, with a metric using each, which custom labels must not
+// use since the series would have duplicate label names.
+var metricLabelNames = map[string]string{
+	"alias":            "docker_container_link_info",
+	"apparmor_profile": "docker_container_security_info",
+	"capabilities":     "docker_container_device_info",
+	"capability":       "docker_container_capability_added",
+	"cgroup_driver":    "docker_container_cgroup_info",
+	"cgroup_path":      "docker_container_cgroup_info",
+	"command":          "docker_container_command_info",
+	"command_hash":     "docker_container_command_info",
+	"condition":        "docker_container_depends_on_info",
+	"container_path":   "docker_container_host_device_info",
+	"count":            "docker_container_device_info",
+	"depends_on":       "docker_container_depends_on_info",
+	"destination":      "docker_container_sensitive_mount_info",
+	"device":           "docker_container_blkio_read_bytes_total",
+	"device_ids":       "docker_container_device_info",
+	"dns_search":       "docker_container_dns_info",
+	"dns_servers":      "docker_container_dns_info",
+	"domainname":       "docker_container_dns_info",
+	"driver":           "docker_container_device_info",
+	"env_hash":         "docker_container_env_info",
+	"family":           "docker_container_network_family_rx_bytes_total",
+	"host_path":        "docker_container_host_device_info",
+	"hostname":         "docker_container_dns_info",
+	"interface":        "docker_container_network_interface_mtu_bytes",
+	"mountpoint":       "docker_container_tmpfs_size_bytes",
+	"op":               "docker_container_blkio_bytes_total",
+	"output":           "docker_container_health_output_info",
+	"permissions":      "docker_container_host_device_info",
+	"process_state":    "docker_container_processes",
+	"rw":               "docker_container_sensitive_mount_info",
+	"seccomp_profile":  "docker_container_security_info",
+	"source":           "docker_container_sensitive_mount_info",
+	"status":           "docker_container_health_status",
+	"target":           "docker_container_link_info",
+	"userns_mode":      "docker_container_security_info",
+}
+
+// sendWithLabels sends a metric with the labels of the container and
+// additional labels.
+func (m *containerMetrics) sendWithLabels(name string, valueType prometheus.ValueType, value float64, labels []string, values ...string) {
+	labelsNames := append(m.labelsNames[:len(m.labelsNames):len(m.labelsNames)], labels...)
+	labelsValues := append(m.labelsValues[:len(m.labelsValues):len(m.labelsValues)], values...)
+	labelPairs := makeLabelPairs(labelsNames, labelsValues)
+	if valueType == prometheus.CounterValue && m.e.counterResets != nil {
+		var start time.Time
+		value, start = m.e.counterResets.adjust(m.containerID, name, values, value, m.startTime)
+		m.sendCreated(name, labelsNames, labelPairs, start)
+	}
+	m.ch <- &constMetric{
+		desc:        m.e.desc(name, labelsNames),
+		valueType:   valueType,
+		value:       value,
+		labelPairs:  labelPairs,
+		timestampMs: m.timestampMs,
+	}
+}
+
+// sendCreated sends the start timestamp of a cumulative counter, if known.
+func (m *containerMetrics) sendCreated(name string, labelsNames []string, labelPairs []*dto.LabelPair, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	name = createdName(name)
+	m.ch <- &constMetric{
+		desc:        m.e.desc(name, labelsNames),
+		valueType:   prometheus.GaugeValue,
+		value:       float64(start.UnixNano()) / 1e9,
+		labelPairs:  labelPairs,
+		timestampMs: m.timestampMs,
+	}
+}
+
+// desc returns the descriptor of a container metric, created on first use.
+// All metrics with the same name have the same labels.
+func (e *exporter) desc(name string, labelsNames []string) *prometheus.Desc {
+	if desc, ok := e.descs.Load(name); ok {
+		return desc.(*prometheus.Desc)
+	}
+	desc, _ := e.descs.LoadOrStore(name, prometheus.NewDesc(name, "", labelsNames, nil))
+	return desc.(*prometheus.Desc)
+}
+
+func makeLabelPairs(labelsNames, labelsValues []string) []*dto.LabelPair {
+	pairs := make([]*dto.LabelPair, len(labelsNames))
+	for i := range labelsNames {
+		pairs[i] = &dto.LabelPair{Name: &labelsNames[i], Value: &labelsValues[i]}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return *pairs[i].Name < *pairs[j].Name })
+	return pairs
+}
+
+// constMetric is a metric with a constant value, like the ones created by
+// prometheus.NewConstMetric but with label pairs built by the caller.
+type constMetric struct {
+	desc        *prometheus.Desc
+	valueType   prometheus.ValueType
+	value       float64
+	labelPairs  []*dto.LabelPair
+	timestampMs *int64
+}
+
+func (m *constMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+func (m *constMetric) Write(out *dto.Metric) error {
+	out.Label = m.labelPairs
+	out.TimestampMs = m.timestampMs
+	switch m.valueType {
+	case prometheus.CounterValue:
+		out.Counter = &dto.Counter{Value: &m.value}
+	case prometheus.GaugeValue:
+		out.Gauge = &dto.Gauge{Value: &m.value}
+	default:
+		out.Untyped = &dto.Untyped{Value: &m.value}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/client"
+)
+
+// mockAPIVersion is the API version reported by the mock Docker daemon.
+const mockAPIVersion = "1.42"
+
+var apiVersionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+
+// mockTransport serves the Docker API from JSON fixtures in a directory, in
+// place of a real Docker daemon:
+//
+//	version.json                 GET /version
+//	info.json                    GET /info
+//	containers.json              GET /containers/json
+//	containers/<id>/inspect.json GET /containers/<id>/json
+//	containers/<id>/stats.json   GET /containers/<id>/stats
+//	images.json                  GET /images/json
+type mockTransport struct {
+	dir string
+}
+
+func (t *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := apiVersionPrefix.ReplaceAllString(req.URL.Path, "")
+	switch {
+	case path == "/_ping":
+		return mockResponse(req, http.StatusOK, "text/plain", []byte("OK")), nil
+	case path == "/events":
+		// no events ever happen, block until the request is canceled
+		body, writer := io.Pipe()
+		go func() {
+			<-req.Context().Done()
+			writer.CloseWithError(req.Context().Err())
+		}()
+		response := mockResponse(req, http.StatusOK, "application/json", nil)
+		response.Body = body
+		return response, nil
+	}
+
+	file := fixtureFile(path)
+	if file == "" {
+		return mockError(req, http.StatusNotFound, fmt.Sprintf("page not found: %s", path)), nil
+	}
+	data, err := os.ReadFile(filepath.Join(t.dir, file))
+	if os.IsNotExist(err) {
+		return mockError(req, http.StatusNotFound, fmt.Sprintf("no such fixture: %s", file)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mockResponse(req, http.StatusOK, "application/json", data), nil
+}
+
+// fixtureFile returns the fixture file of a Docker API path without version
+// prefix, or an empty string if it has none.
+func fixtureFile(path string) string {
+	switch {
+	case path == "/version":
+		return "version.json"
+	case path == "/info":
+		return "info.json"
+	case path == "/containers/json":
+		return "containers.json"
+	case path == "/images/json":
+		return "images.json"
+	case strings.HasPrefix(path, "/containers/"):
+		id, endpoint, _ := strings.Cut(strings.TrimPrefix(path, "/containers/"), "/")
+		switch endpoint {
+		case "json":
+			return filepath.Join("containers", filepath.Base(id), "inspect.json")
+		case "stats":
+			return filepath.Join("containers", filepath.Base(id), "stats.json")
+		}
+	}
+	return ""
+}
+
+func mockResponse(req *http.Request, status int, contentType string, body []byte) *http.Response {
+	return &http.Response{
+		Status:     http.StatusText(status),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Api-Version":  []string{mockAPIVersion},
+			"Content-Type": []string{contentType},
+		},
+		Body:    io.NopCloser(bytes.NewReader(body)),
+		Request: req,
+	}
+}
+
+func mockError(req *http.Request, status int, message string) *http.Response {
+	return mockResponse(req, status, "application/json", []byte(fmt.Sprintf("{\"message\":%q}\n", message)))
+}
+
+// newMockDockerClient creates a Docker client served by a mockTransport from
+// the fixtures in dir, with its HTTP transport wrapped by a dockerTransport.
+func newMockDockerClient(dir string) (*client.Client, *dockerTransport, error) {
+	if _, err := os.Stat(filepath.Join(dir, "containers.json")); err != nil {
+		return nil, nil, fmt.Errorf("invalid mock fixtures: %v", err)
+	}
+	transport := &dockerTransport{RoundTripper: &mockTransport{dir}}
+	docker, err := client.NewClientWithOpts(
+		client.WithHost("tcp://mock:2375"),
+		client.WithAPIVersionNegotiation(),
+		client.WithHTTPClient(&http.Client{Transport: transport}),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	transport.versions = newAPIVersions(docker, false)
+	return docker, transport, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// cardinalityModes are the modes of the collectors selectable in
+// CARDINALITY, with the environment variables each mode sets.
+var cardinalityModes = map[string]map[string]map[string]string{
+	"blkio": {
+		"aggregate":  {"BLKIO_OPS": "false", "BLKIO_PER_DEVICE": "false"},
+		"ops":        {"BLKIO_OPS": "true", "BLKIO_PER_DEVICE": "false"},
+		"per-device": {"BLKIO_OPS": "false", "BLKIO_PER_DEVICE": "true"},
+	},
+	"network": {
+		"aggregate":     {"NETWORK_PER_INTERFACE": "false"},
+		"per-interface": {"NETWORK_PER_INTERFACE": "true"},
+	},
+}
+
+// applyCardinality sets the environment variables of the modes of the
+// collectors in value, made of "collector=mode" items separated by commas.
+// Modes take precedence over profiles, and must not contradict variables
+// set explicitly.
+func applyCardinality(value string) error {
+	settings := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		collector, mode, _ := strings.Cut(strings.TrimSpace(item), "=")
+		modes, ok := cardinalityModes[collector]
+		if !ok {
+			return fmt.Errorf("unknown collector %q: must be one of %s", collector, sortedKeys(cardinalityModes))
+		}
+		envs, ok := modes[mode]
+		if !ok {
+			return fmt.Errorf("unknown %s mode %q: must be one of %s", collector, mode, sortedKeys(modes))
+		}
+		for env, value := range envs {
+			if explicit, ok := os.LookupEnv(env); ok && explicit != value {
+				return fmt.Errorf("%s=%s conflicts with %s=%s", collector, mode, env, explicit)
+			}
+			settings[env] = value
+		}
+	}
+	for env, value := range settings {
+		os.Setenv(env, value)
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectNetworkFamilies exports the IP bytes received and sent by the
+// network namespace of a container for each address family, read through
+// the /proc of the host mounted at procPath. The IPv6 counters are missing
+// when IPv6 is disabled in the namespace.
+func collectNetworkFamilies(m *containerMetrics, procPath string, pid int) error {
+	netPath := filepath.Join(procPath, strconv.Itoa(pid), "net")
+
+	ipv4, err := readNetstat(filepath.Join(netPath, "netstat"), "IpExt")
+	if err != nil {
+		return &collectError{reasonOther, fmt.Errorf("cannot read IPv4 statistics: %v", err)}
+	}
+	sendNetworkFamily(m, "ipv4", ipv4["InOctets"], ipv4["OutOctets"])
+
+	ipv6, err := readSnmp6(filepath.Join(netPath, "snmp6"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return &collectError{reasonOther, fmt.Errorf("cannot read IPv6 statistics: %v", err)}
+	}
+	sendNetworkFamily(m, "ipv6", ipv6["Ip6InOctets"], ipv6["Ip6OutOctets"])
+	return nil
+}
+
+func sendNetworkFamily(m *containerMetrics, family string, rxBytes, txBytes uint64) {
+	m.sendWithLabels("docker_container_network_family_rx_bytes_total", prometheus.CounterValue, float64(rxBytes),
+		[]string{"family"},
+		family)
+	m.sendWithLabels("docker_container_network_family_tx_bytes_total", prometheus.CounterValue, float64(txBytes),
+		[]string{"family"},
+		family)
+}
+
+// readNetstat parses the counters of a section of a /proc/net/netstat or
+// /proc/net/snmp file, made of a line of names followed by a line of values.
+func readNetstat(path, section string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	prefix := section + ":"
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != prefix {
+			continue
+		}
+		if names == nil {
+			names = fields[1:]
+			continue
+		}
+		if len(fields)-1 != len(names) {
+			return nil, fmt.Errorf("mismatched %s counters in %s", section, path)
+		}
+		counters := make(map[string]uint64, len(names))
+		for i, name := range names {
+			value, err := strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s counter %s in %s", section, name, path)
+			}
+			counters[name] = value
+		}
+		return counters, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no %s counters in %s", section, path)
+}
+
+// readSnmp6 parses the counters of a /proc/net/snmp6 file, made of a name
+// and a value on each line.
+func readSnmp6(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	counters := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid counter %s in %s", fields[0], path)
+		}
+		counters[fields[0]] = value
+	}
+	return counters, scanner.Err()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectNetworkInterfaces exports the MTU and link speed of the network
+// interfaces of a container, read from the sysfs of its network namespace
+// through the /proc of the host mounted at procPath.
+func collectNetworkInterfaces(m *containerMetrics, procPath string, pid int) error {
+	netPath := filepath.Join(procPath, strconv.Itoa(pid), "root", "sys", "class", "net")
+	entries, err := os.ReadDir(netPath)
+	if err != nil {
+		return &collectError{reasonOther, fmt.Errorf("cannot list network interfaces: %v", err)}
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == "lo" {
+			continue
+		}
+		if mtu, err := readSysfsInt(filepath.Join(netPath, name, "mtu")); err == nil {
+			m.sendWithLabels("docker_container_network_interface_mtu_bytes", prometheus.GaugeValue, float64(mtu),
+				[]string{"interface"},
+				name)
+		}
+		// the speed is unknown for some interfaces, such as -1 or an error
+		// for those without carrier
+		if speed, err := readSysfsInt(filepath.Join(netPath, name, "speed")); err == nil && speed > 0 {
+			m.sendWithLabels("docker_container_network_interface_speed_bytes_per_second", prometheus.GaugeValue, float64(speed)*1000*1000/8,
+				[]string{"interface"},
+				name)
+		}
+	}
+	return nil
+}
+
+func readSysfsInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
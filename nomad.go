@@ -0,0 +1,57 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+var nomadLabelNames = []string{"nomad_job", "nomad_group", "nomad_task", "nomad_alloc_id"}
+
+// nomadSources are the container labels and environmental variables set by
+// the Nomad Docker driver for each of nomadLabelNames.
+var nomadSources = []struct {
+	label string
+	env   string
+}{
+	{"com.hashicorp.nomad.job_name", "NOMAD_JOB_NAME"},
+	{"com.hashicorp.nomad.task_group_name", "NOMAD_GROUP_NAME"},
+	{"com.hashicorp.nomad.task_name", "NOMAD_TASK_NAME"},
+	{"com.hashicorp.nomad.alloc_id", "NOMAD_ALLOC_ID"},
+}
+
+// nomadContainerName matches the "<task>-<alloc_id>" container names of the
+// Nomad Docker driver.
+var nomadContainerName = regexp.MustCompile(`^(.+)-([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$`)
+
+// nomadLabels returns the values of nomadLabelNames for a container, which
+// are empty for containers not launched by Nomad.
+func nomadLabels(name string, containerJson types.ContainerJSON) []string {
+	env := make(map[string]string)
+	if containerJson.Config != nil {
+		for _, variable := range containerJson.Config.Env {
+			key, value, _ := strings.Cut(variable, "=")
+			if strings.HasPrefix(key, "NOMAD_") {
+				env[key] = value
+			}
+		}
+	}
+
+	values := make([]string, len(nomadSources))
+	for i, source := range nomadSources {
+		if containerJson.Config != nil && containerJson.Config.Labels[source.label] != "" {
+			values[i] = containerJson.Config.Labels[source.label]
+		} else {
+			values[i] = env[source.env]
+		}
+	}
+
+	if match := nomadContainerName.FindStringSubmatch(name); match != nil && values[3] == "" {
+		if values[2] == "" {
+			values[2] = match[1]
+		}
+		values[3] = match[2]
+	}
+	return values
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// oomTracker counts the OOM events of containers, which are emitted every
+// time a process of a container is killed by the OOM killer, even when the
+// container keeps running.
+type oomTracker struct {
+	mu    sync.Mutex
+	total map[string]int
+}
+
+func newOOMTracker() *oomTracker {
+	return &oomTracker{
+		total: make(map[string]int),
+	}
+}
+
+func (t *oomTracker) handleEvent(message events.Message) {
+	if message.Type != events.ContainerEventType {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch message.Action {
+	case "oom":
+		t.total[message.Actor.ID]++
+	case "destroy":
+		delete(t.total, message.Actor.ID)
+	}
+}
+
+// count returns the number of OOM events of a container since the exporter
+// started.
+func (t *oomTracker) count(containerID string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total[containerID]
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// pauseTracker accumulates the time containers spend paused, from pause and
+// unpause events.
+type pauseTracker struct {
+	mu     sync.Mutex
+	total  map[string]time.Duration
+	paused map[string]time.Time
+}
+
+func newPauseTracker() *pauseTracker {
+	return &pauseTracker{
+		total:  make(map[string]time.Duration),
+		paused: make(map[string]time.Time),
+	}
+}
+
+func (t *pauseTracker) handleEvent(message events.Message) {
+	if message.Type != events.ContainerEventType {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch message.Action {
+	case "pause":
+		t.paused[message.Actor.ID] = eventTime(message)
+	case "unpause":
+		if since, ok := t.paused[message.Actor.ID]; ok {
+			t.total[message.Actor.ID] += eventTime(message).Sub(since)
+			delete(t.paused, message.Actor.ID)
+		}
+	case "destroy":
+		delete(t.total, message.Actor.ID)
+		delete(t.paused, message.Actor.ID)
+	}
+}
+
+// pausedTime returns the total time a container has spent paused, given its
+// current state, which is reconciled with the events: containers already
+// paused when the exporter started, or whose pause event was missed, are
+// counted from the first time they are seen paused, and containers seen not
+// paused stop accruing when their unpause event was missed.
+func (t *pauseTracker) pausedTime(containerID, state string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	since, paused := t.paused[containerID]
+	switch {
+	case state == "paused" && !paused:
+		t.paused[containerID] = now
+		since, paused = now, true
+	case state != "paused" && paused:
+		t.total[containerID] += now.Sub(since)
+		delete(t.paused, containerID)
+		paused = false
+	}
+	total := t.total[containerID]
+	if paused {
+		total += now.Sub(since)
+	}
+	return total
+}
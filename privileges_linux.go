@@ -0,0 +1,89 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// dropPrivileges switches the process to an unprivileged user and group,
+// keeping access to the Docker socket through a supplementary group.
+func dropPrivileges(userName, groupName string, groupNames []string, socketPath string) error {
+	uid, primaryGid, err := lookupUser(userName)
+	if err != nil {
+		return err
+	}
+	gid := primaryGid
+	if groupName != "" {
+		gid, err = lookupGroup(groupName)
+		if err != nil {
+			return err
+		}
+	}
+
+	groups := []int{}
+	for _, name := range groupNames {
+		id, err := lookupGroup(name)
+		if err != nil {
+			return err
+		}
+		groups = append(groups, id)
+	}
+	if socketPath != "" {
+		info, err := os.Stat(socketPath)
+		if err != nil {
+			return fmt.Errorf("cannot stat docker socket: %v", err)
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			groups = append(groups, int(stat.Gid))
+		}
+	}
+
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("cannot set supplementary groups: %v", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("cannot set group: %v", err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("cannot set user: %v", err)
+	}
+	return nil
+}
+
+// lookupUser returns the ID and primary group ID of a user given by name or
+// ID. Numeric IDs are accepted without a user database, as in scratch images.
+func lookupUser(name string) (uid, gid int, err error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		if u, err := user.LookupId(name); err == nil {
+			gid, _ := strconv.Atoi(u.Gid)
+			return id, gid, nil
+		}
+		return id, id, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	uid, _ = strconv.Atoi(u.Uid)
+	gid, _ = strconv.Atoi(u.Gid)
+	return uid, gid, nil
+}
+
+// lookupGroup returns the ID of a group given by name or ID.
+func lookupGroup(name string) (int, error) {
+	name = strings.TrimSpace(name)
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
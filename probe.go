@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	probeLabel        = "docker-stats-exporter.probe"
+	probeNetworkLabel = "docker-stats-exporter.probe.network"
+	probeTimeout      = 2 * time.Second
+)
+
+var probeClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// collectProbe probes the target set in the probe label of a container, such
+// as "http://:8080/health" or "tcp://:5432", and exports its success and
+// duration. Targets without a host are probed on the IP address of the
+// container in the network set in the probe network label, or else in the
+// first of its networks by name. Targets with a host must be an IP address
+// of the container, so that the label cannot be used to send requests from
+// the exporter to other hosts. Probes are bounded by the context of the
+// scrape and by probeTimeout.
+func collectProbe(ctx context.Context, m *containerMetrics, container *types.Container, containerJson types.ContainerJSON) error {
+	target, ok := container.Labels[probeLabel]
+	if !ok {
+		return nil
+	}
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return &collectError{reasonConfig, fmt.Errorf("invalid probe target %q: %v", target, err)}
+	}
+	if host := targetURL.Hostname(); host == "" {
+		network := container.Labels[probeNetworkLabel]
+		ip := containerIP(containerJson, network)
+		if ip == "" && network != "" {
+			return &collectError{reasonConfig, fmt.Errorf("no IP address in network %q to probe %q", network, target)}
+		}
+		if ip == "" {
+			return &collectError{reasonConfig, fmt.Errorf("no IP address to probe %q", target)}
+		}
+		targetURL.Host = net.JoinHostPort(ip, targetURL.Port())
+	} else if !hasIP(containerJson, host) {
+		return &collectError{reasonConfig, fmt.Errorf("probe target %q is not an IP address of the container", target)}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	start := time.Now()
+	success := false
+	switch targetURL.Scheme {
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL.String(), nil)
+		if err != nil {
+			return &collectError{reasonConfig, err}
+		}
+		if resp, err := probeClient.Do(req); err == nil {
+			resp.Body.Close()
+			success = resp.StatusCode < 400
+		}
+	case "tcp":
+		var dialer net.Dialer
+		if conn, err := dialer.DialContext(ctx, "tcp", targetURL.Host); err == nil {
+			conn.Close()
+			success = true
+		}
+	default:
+		return &collectError{reasonConfig, fmt.Errorf("unsupported probe scheme %q", targetURL.Scheme)}
+	}
+	duration := time.Since(start)
+
+	m.send("docker_container_probe_success", prometheus.GaugeValue, boolToFloat(success))
+	m.send("docker_container_probe_duration_seconds", prometheus.GaugeValue, duration.Seconds())
+	return nil
+}
+
+// containerIP returns the IP address of a container in a network, or its
+// first IP address across its networks in the order of their names if
+// network is empty.
+func containerIP(containerJson types.ContainerJSON, network string) string {
+	if containerJson.NetworkSettings == nil {
+		return ""
+	}
+	names := []string{network}
+	if network == "" {
+		names = make([]string, 0, len(containerJson.NetworkSettings.Networks))
+		for name := range containerJson.NetworkSettings.Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		network, ok := containerJson.NetworkSettings.Networks[name]
+		if !ok || network == nil {
+			continue
+		}
+		if network.IPAddress != "" {
+			return network.IPAddress
+		}
+		if network.GlobalIPv6Address != "" {
+			return network.GlobalIPv6Address
+		}
+	}
+	return ""
+}
+
+// hasIP returns whether host is an IP address of a container in any of its
+// networks.
+func hasIP(containerJson types.ContainerJSON, host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil || containerJson.NetworkSettings == nil {
+		return false
+	}
+	for _, network := range containerJson.NetworkSettings.Networks {
+		if network == nil {
+			continue
+		}
+		for _, address := range []string{network.IPAddress, network.GlobalIPv6Address} {
+			if address != "" && ip.Equal(net.ParseIP(address)) {
+				return true
+			}
+		}
+	}
+	return false
+}
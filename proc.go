@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// containerPIDs returns the PIDs of the processes of a container, read from
+// the cgroup.procs file of its cgroup.
+func (e *exporter) containerPIDs(ctx context.Context, containerJson types.ContainerJSON) ([]int, error) {
+	dir, err := e.cgroups.dir(ctx, containerJson, "pids")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pids := []int{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		pid, err := strconv.Atoi(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("invalid PID %q in cgroup.procs", scanner.Text())
+		}
+		pids = append(pids, pid)
+	}
+	return pids, scanner.Err()
+}
+
+// collectProcesses exports the metrics of the processes of a container read
+// from the /proc of the host mounted at e.procPath. Processes exiting while
+// being read are skipped.
+func (e *exporter) collectProcesses(ctx context.Context, m *containerMetrics, containerJson types.ContainerJSON) error {
+	pids, err := e.containerPIDs(ctx, containerJson)
+	if err != nil {
+		return &collectError{reasonOther, fmt.Errorf("cannot list processes: %v", err)}
+	}
+
+	fds, threads, zombie, uninterruptible := 0, 0, 0, 0
+	for _, pid := range pids {
+		pidPath := filepath.Join(e.procPath, strconv.Itoa(pid))
+		if stat, err := readProcStat(filepath.Join(pidPath, "stat")); err == nil {
+			threads += stat.threads
+			switch stat.state {
+			case "Z":
+				zombie++
+			case "D":
+				uninterruptible++
+			}
+		}
+		f, err := os.Open(filepath.Join(pidPath, "fd"))
+		if err != nil {
+			continue
+		}
+		names, err := f.Readdirnames(-1)
+		f.Close()
+		if err == nil {
+			fds += len(names)
+		}
+	}
+	m.send("docker_container_file_descriptors", prometheus.GaugeValue, float64(fds))
+	m.send("docker_container_threads", prometheus.GaugeValue, float64(threads))
+	m.sendWithLabels("docker_container_processes", prometheus.GaugeValue, float64(zombie),
+		[]string{"process_state"},
+		"zombie")
+	m.sendWithLabels("docker_container_processes", prometheus.GaugeValue, float64(uninterruptible),
+		[]string{"process_state"},
+		"uninterruptible")
+
+	if containerJson.State != nil {
+		if limit, ok := openFilesLimit(filepath.Join(e.procPath, strconv.Itoa(containerJson.State.Pid), "limits")); ok {
+			m.send("docker_container_file_descriptors_limit", prometheus.GaugeValue, limit)
+		}
+	}
+	return nil
+}
+
+// procStat is the status of a process from its /proc stat file.
+type procStat struct {
+	state   string
+	threads int
+}
+
+func readProcStat(path string) (procStat, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return procStat{}, err
+	}
+	// the command name in parentheses may contain spaces and parentheses
+	i := strings.LastIndexByte(string(data), ')')
+	if i < 0 {
+		return procStat{}, fmt.Errorf("unexpected stat format in %s", path)
+	}
+	// fields from the state, the third field of the file
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 18 {
+		return procStat{}, fmt.Errorf("unexpected stat format in %s", path)
+	}
+	threads, err := strconv.Atoi(fields[17])
+	if err != nil {
+		return procStat{}, fmt.Errorf("invalid number of threads in %s: %v", path, err)
+	}
+	return procStat{state: fields[0], threads: threads}, nil
+}
+
+// openFilesLimit returns the soft limit of open files in a /proc limits file,
+// if it is not unlimited.
+func openFilesLimit(path string) (float64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, "Max open files"); ok {
+			fields := strings.Fields(rest)
+			if len(fields) == 0 {
+				return 0, false
+			}
+			limit, err := strconv.ParseFloat(fields[0], 64)
+			return limit, err == nil
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+)
+
+// profiles are the predefined sets of defaults of environment variables
+// selected by PROFILE, which are overridden by variables set explicitly.
+// The variables of profiles are read with getenv.
+func profiles() map[string]map[string]string {
+	concurrency := defaultConcurrency
+	if 4*runtime.NumCPU() > concurrency {
+		concurrency = 4 * runtime.NumCPU()
+	}
+	full := map[string]string{
+		"CONCURRENCY":        strconv.Itoa(concurrency),
+		"STATS_MODE":         statsModePrevious,
+		"BLKIO_OPS":          "true",
+		"CGROUP_INFO":        "true",
+		"CPU_MAX":            "true",
+		"PROCESS_METRICS":    "true",
+		"NETWORK_INTERFACES": "true",
+		"NETWORK_FAMILIES":   "true",
+		"CONNTRACK_METRICS":  "true",
+		"PAUSE_METRICS":      "true",
+		"OOM_METRICS":        "true",
+		"LIFETIME_METRICS":   "true",
+		"HOST_METRICS":       "true",
+	}
+	debug := map[string]string{
+		"DEBUG_ENDPOINTS": "true",
+		"CGROUP_LABEL":    "true",
+		"GO_METRICS":      "true",
+		"HISTORY_SAMPLES": "60",
+	}
+	for name, value := range full {
+		debug[name] = value
+	}
+	return map[string]map[string]string{
+		"minimal": {
+			"CONCURRENCY":        "2",
+			"INFO_LABELS":        "false",
+			"WARM_UP":            "false",
+			"BLKIO_OPS":          "false",
+			"CGROUP_INFO":        "false",
+			"CPU_MAX":            "false",
+			"PROCESS_METRICS":    "false",
+			"NETWORK_INTERFACES": "false",
+			"NETWORK_FAMILIES":   "false",
+			"CONNTRACK_METRICS":  "false",
+			"PAUSE_METRICS":      "false",
+			"OOM_METRICS":        "false",
+			"LIFETIME_METRICS":   "false",
+			"HOST_METRICS":       "false",
+			"IMAGE_METRICS":      "false",
+			"BUILDER_METRICS":    "false",
+		},
+		"default": {},
+		"full":    full,
+		"debug":   debug,
+	}
+}
+
+// applyProfile sets the defaults of environment variables to a profile.
+func applyProfile(name string) error {
+	all := profiles()
+	profile, ok := all[name]
+	if !ok {
+		return fmt.Errorf("must be one of %s", sortedKeys(all))
+	}
+	envDefaults = profile
+	return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sensitiveInfoKeys are the keys removed from recorded /info responses.
+var sensitiveInfoKeys = []string{"ID", "Name", "HttpProxy", "HttpsProxy", "NoProxy", "RegistryConfig", "Swarm"}
+
+// recordCommand runs a single collection round and records the Docker API
+// responses to a directory, in the fixture layout of the mock mode, so that
+// users can attach reproducible data to bug reports.
+func recordCommand(e *exporter, args []string) int {
+	flags := flag.NewFlagSet("record", flag.ContinueOnError)
+	dir := flags.String("record-dir", "", "directory to record the Docker API responses to")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "usage: docker_stats_exporter record --record-dir <directory>")
+		return 2
+	}
+
+	recorder := &recordingTransport{RoundTripper: e.transport.RoundTripper, dir: *dir}
+	e.transport.RoundTripper = recorder
+
+	ctx := context.Background()
+	for _, record := range []func() error{
+		func() error { _, err := e.docker.ServerVersion(ctx); return err },
+		func() error { _, err := e.docker.Info(ctx); return err },
+	} {
+		if err := record(); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot query the Docker daemon: %v\n", err)
+			return 1
+		}
+	}
+	ch := make(chan prometheus.Metric)
+	go func() {
+		e.collect(ctx, ch, collectOptions{})
+		close(ch)
+	}()
+	for range ch {
+	}
+
+	if recorder.err != nil {
+		fmt.Fprintf(os.Stderr, "cannot record responses: %v\n", recorder.err)
+		return 1
+	}
+	fmt.Printf("recorded %d responses to %s, environment variable values redacted\n", recorder.recorded, *dir)
+	return 0
+}
+
+// recordingTransport writes the responses of the Docker API paths having a
+// fixture file to dir, with sensitive values redacted. The stats samples of
+// a container are appended to its stats file, so that the samples of all
+// its stats requests are kept.
+type recordingTransport struct {
+	http.RoundTripper
+	dir string
+
+	mu       sync.Mutex
+	recorded int
+	err      error
+	// created are the stats files created by the recording, which are
+	// appended to instead of overwritten
+	created map[string]bool
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	response, err := t.RoundTripper.RoundTrip(req)
+	if err != nil || response.StatusCode != http.StatusOK {
+		return response, err
+	}
+	file := fixtureFile(apiVersionPrefix.ReplaceAllString(req.URL.Path, ""))
+	if file == "" {
+		return response, nil
+	}
+	path := filepath.Join(t.dir, file)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.fail(err)
+		return response, nil
+	}
+
+	if filepath.Base(file) == "stats.json" {
+		// stats may be streamed, record them as they are read
+		body := &recordingBody{body: response.Body, transport: t, path: path}
+		body.Reader = io.TeeReader(response.Body, &body.data)
+		response.Body = body
+		return response, nil
+	}
+
+	data, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(data))
+	sanitized, err := sanitizeFixture(filepath.Base(file), data)
+	if err == nil {
+		err = os.WriteFile(path, sanitized, 0o644)
+	}
+	if err != nil {
+		t.fail(fmt.Errorf("%s: %v", file, err))
+		return response, nil
+	}
+	t.done()
+	return response, nil
+}
+
+func (t *recordingTransport) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recorded++
+}
+
+func (t *recordingTransport) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+// appendSamples appends the complete stats samples of data to a stats file,
+// truncating the file first if it was not created by the recording.
+func (t *recordingTransport) appendSamples(path string, data []byte) {
+	var samples bytes.Buffer
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		// a sample cut off by the end of a streamed response is dropped
+		var sample json.RawMessage
+		if err := decoder.Decode(&sample); err != nil {
+			break
+		}
+		samples.Write(sample)
+		samples.WriteByte('\n')
+	}
+	if samples.Len() == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !t.created[path] {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err == nil {
+		_, err = f.Write(samples.Bytes())
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		if t.err == nil {
+			t.err = err
+		}
+		return
+	}
+	if t.created == nil {
+		t.created = make(map[string]bool)
+	}
+	if !t.created[path] {
+		t.created[path] = true
+		t.recorded++
+	}
+}
+
+// recordingBody is a response body whose stats samples are recorded once it
+// is closed.
+type recordingBody struct {
+	io.Reader
+	body      io.Closer
+	transport *recordingTransport
+	path      string
+	data      bytes.Buffer
+}
+
+func (b *recordingBody) Close() error {
+	b.transport.appendSamples(b.path, b.data.Bytes())
+	return b.body.Close()
+}
+
+// sanitizeFixture redacts the values of environment variables from inspect
+// responses and host details from info responses, and indents the JSON.
+// Other values, such as labels, commands, and mounts, are recorded as is.
+func sanitizeFixture(file string, data []byte) ([]byte, error) {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	switch file {
+	case "inspect.json":
+		if inspect, ok := value.(map[string]any); ok {
+			if config, ok := inspect["Config"].(map[string]any); ok {
+				if env, ok := config["Env"].([]any); ok {
+					for i, variable := range env {
+						if variable, ok := variable.(string); ok {
+							name, _, _ := strings.Cut(variable, "=")
+							env[i] = name + "=redacted"
+						}
+					}
+				}
+			}
+		}
+	case "info.json":
+		if info, ok := value.(map[string]any); ok {
+			for _, key := range sensitiveInfoKeys {
+				delete(info, key)
+			}
+		}
+	}
+	data, err := json.MarshalIndent(value, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// renderLabelCommand evaluates a label template against the data of a live
+// container, to help develop custom label templates.
+func renderLabelCommand(e *exporter, args []string) int {
+	flags := flag.NewFlagSet("render-label", flag.ContinueOnError)
+	name := flags.String("container", "", "name or ID of the container to render the template for")
+	text := flags.String("template", "", "label template to render")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" || *text == "" {
+		fmt.Fprintln(os.Stderr, "usage: docker_stats_exporter render-label --container <name> --template <template>")
+		return 2
+	}
+
+	tmpl, err := template.New("label").Parse(*text)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid template: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	containerJson, err := e.docker.ContainerInspect(ctx, *name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot inspect container %s: %v\n", *name, err)
+		return 1
+	}
+	containers, err := e.docker.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("id", containerJson.ID)),
+	})
+	if err != nil || len(containers) == 0 {
+		fmt.Fprintf(os.Stderr, "cannot list container %s: %v\n", *name, err)
+		return 1
+	}
+
+	value, err := e.labelLimits.execute(labelTemplate{"label", tmpl}, &containers[0], containerJson)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot render template: %v\n", err)
+		return 1
+	}
+	fmt.Println(value)
+	return 0
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// counterResets keeps the counters of containers cumulative across their
+// restarts, which reset the counters of the daemon, for systems ingesting
+// samples without handling counter resets. Values lower than the previous
+// value of a counter are added to the total of its previous values, and the
+// start of each counter is the start of the container when first seen.
+type counterResets struct {
+	mu   sync.Mutex
+	byID map[string]*containerCounters
+}
+
+// containerCounters are the counters of a container, with the collection
+// round of the container they were last seen in.
+type containerCounters struct {
+	round    uint64
+	counters map[string]*counterReset
+}
+
+type counterReset struct {
+	name   string
+	last   float64
+	offset float64
+	start  time.Time
+	round  uint64
+}
+
+func newCounterResets() *counterResets {
+	return &counterResets{byID: make(map[string]*containerCounters)}
+}
+
+// begin starts a collection round of a container.
+func (r *counterResets) begin(containerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counters, ok := r.byID[containerID]
+	if !ok {
+		counters = &containerCounters{counters: make(map[string]*counterReset)}
+		r.byID[containerID] = counters
+	}
+	counters.round++
+}
+
+// adjust returns the cumulative value and the start of a counter of a
+// container, given its value reported by the daemon and the start of the
+// container.
+func (r *counterResets) adjust(containerID, name string, labelsValues []string, value float64, start time.Time) (float64, time.Time) {
+	key := name
+	if len(labelsValues) > 0 {
+		key += "\x00" + strings.Join(labelsValues, "\x00")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counters, ok := r.byID[containerID]
+	if !ok {
+		counters = &containerCounters{counters: make(map[string]*counterReset)}
+		r.byID[containerID] = counters
+	}
+	counter, ok := counters.counters[key]
+	if !ok {
+		counter = &counterReset{name: name, start: start}
+		counters.counters[key] = counter
+	}
+	if value < counter.last {
+		counter.offset += counter.last
+	}
+	counter.last = value
+	counter.round = counters.round
+	return value + counter.offset, counter.start
+}
+
+// prune removes the counters of a container not seen in its collection
+// round, such as the counters of removed network interfaces, for the
+// counters sent in the round. The counters not sent at all, such as the
+// usage of stopped containers, are kept until the container restarts.
+func (r *counterResets) prune(containerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counters, ok := r.byID[containerID]
+	if !ok {
+		return
+	}
+	sent := make(map[string]bool)
+	for _, counter := range counters.counters {
+		if counter.round == counters.round {
+			sent[counter.name] = true
+		}
+	}
+	for key, counter := range counters.counters {
+		if counter.round != counters.round && sent[counter.name] {
+			delete(counters.counters, key)
+		}
+	}
+}
+
+// retain removes the counters of containers not in containers.
+func (r *counterResets) retain(containers []types.Container) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	listed := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		listed[container.ID] = true
+	}
+	for id := range r.byID {
+		if !listed[id] {
+			delete(r.byID, id)
+		}
+	}
+}
+
+// createdName returns the name of the start timestamp of a counter.
+func createdName(name string) string {
+	return strings.TrimSuffix(name, "_total") + "_created"
+}
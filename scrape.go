@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// scrapeTimeoutOffset is subtracted from the scrape timeout requested by
+// Prometheus to leave time for the response to be sent.
+const scrapeTimeoutOffset = 500 * time.Millisecond
+
+// scrape collects the metrics of an exporter within the deadline of a single
+// scrape request.
+type scrape struct {
+	*exporter
+	ctx  context.Context
+	opts collectOptions
+}
+
+func (s *scrape) Collect(ch chan<- prometheus.Metric) {
+	s.collect(s.ctx, ch, s.opts)
+	if s.opts.container != "" {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc(
+		"docker_exporter_scrape_timeout_hit", "",
+		nil, nil),
+		prometheus.GaugeValue,
+		boolToFloat(s.ctx.Err() == context.DeadlineExceeded))
+}
+
+func newMetricsHandler(e *exporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveScrape(w, r, e, collectOptions{})
+	})
+}
+
+// newMetricsSubsetHandler serves a subset of the metrics at
+// /metrics/<name>.
+func newMetricsSubsetHandler(e *exporter, subset metricsSubset) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveScrape(w, r, e, collectOptions{metrics: subset.patterns})
+	})
+}
+
+// newContainerMetricsHandler serves the metrics of a single container at
+// /containers/{name}/metrics.
+func newContainerMetricsHandler(e *exporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := strings.CutPrefix(r.URL.Path, "/containers/")
+		name, found := strings.CutSuffix(name, "/metrics")
+		if !ok || !found || name == "" || strings.Contains(name, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		serveScrape(w, r, e, collectOptions{container: name})
+	})
+}
+
+func serveScrape(w http.ResponseWriter, r *http.Request, e *exporter, opts collectOptions) {
+	labels, err := parseURLLabels(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if timeout, ok := scrapeTimeout(r); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&scrape{e, ctx, opts})
+	gatherers := prometheus.Gatherers{registry}
+	if opts.container == "" {
+		registry.MustRegister(e.collectors...)
+		gatherers = append(gatherers, e.gatherers...)
+	}
+	var gatherer prometheus.Gatherer = gatherers
+	if len(opts.metrics) > 0 {
+		gatherer = &filteredGatherer{gatherers, opts.metrics}
+	}
+	if len(labels) > 0 {
+		gatherer = &labeledGatherer{gatherer, labels}
+	}
+	serveEncoded(promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}), w, r)
+}
+
+// scrapeTimeout returns the time available for collection according to the
+// timeout of the scrape request sent by Prometheus.
+func scrapeTimeout(r *http.Request) (time.Duration, bool) {
+	seconds, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64)
+	if err != nil || seconds <= 0 {
+		return 0, false
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > 2*scrapeTimeoutOffset {
+		timeout -= scrapeTimeoutOffset
+	} else {
+		timeout /= 2
+	}
+	return timeout, true
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// targetLabels are the labels Prometheus attaches to scraped metrics, which
+// conflict with custom labels of the same name.
+var targetLabels = []string{"instance", "job"}
+
+// printScrapeConfigCommand prints a Prometheus scrape config for the exporter
+// as configured by the environment.
+func printScrapeConfigCommand(e *exporter, args []string) int {
+	flags := flag.NewFlagSet("print-scrape-config", flag.ContinueOnError)
+	jobName := flags.String("job-name", "docker", "name of the scrape job")
+	target := flags.String("target", "", "address Prometheus scrapes the exporter at (default: the hostname and the port of TLS_ADDR, or of the first address of ADDR)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	// metrics are scraped over TLS when served over TLS
+	tls := getenv("TLS_ADDR") != ""
+	if *target == "" {
+		addrEnv, addrs := "ADDR", listenAddrs()
+		if tls {
+			addrEnv, addrs = "TLS_ADDR", []string{getenv("TLS_ADDR")}
+		}
+		if len(addrs) == 0 {
+			fmt.Fprintln(os.Stderr, "no address in ADDR, set --target")
+			return 1
+		}
+		_, port, err := net.SplitHostPort(addrs[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid %s: %v\n", addrEnv, err)
+			return 1
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cannot get hostname: %v\n", err)
+			return 1
+		}
+		*target = net.JoinHostPort(hostname, port)
+	}
+
+	conflicts := []string{}
+	for _, label := range e.extraLabels {
+		for _, targetLabel := range targetLabels {
+			if label.name == targetLabel {
+				conflicts = append(conflicts, label.name)
+			}
+		}
+	}
+
+	fmt.Println("scrape_configs:")
+	fmt.Printf("  - job_name: %s\n", *jobName)
+	if len(conflicts) > 0 {
+		fmt.Printf("    # keep custom labels conflicting with target labels (%s) instead of renaming them to exported_*\n", strings.Join(conflicts, ", "))
+		fmt.Println("    honor_labels: true")
+	}
+	if tls {
+		fmt.Println("    scheme: https")
+		fmt.Println("    tls_config:")
+		fmt.Println("      # CA of the certificate in TLS_CERT_FILE, replace with its path")
+		fmt.Println("      ca_file: /etc/prometheus/docker_stats_exporter-ca.pem")
+		if getenv("TLS_CLIENT_CA_FILE") != "" {
+			fmt.Println("      # certificate signed by a CA of TLS_CLIENT_CA_FILE, replace with its path")
+			fmt.Println("      cert_file: /etc/prometheus/client.pem")
+			fmt.Println("      key_file: /etc/prometheus/client.key")
+		}
+	}
+	fmt.Println("    static_configs:")
+	fmt.Println("      - targets:")
+	if e.shardTotal > 0 {
+		fmt.Printf("          # one target for each of the %d shards, replace with their addresses\n", e.shardTotal)
+		for i := uint32(0); i < e.shardTotal; i++ {
+			fmt.Printf("          - %s # SHARD_INDEX=%d\n", *target, i)
+		}
+	} else {
+		fmt.Printf("          - %s\n", *target)
+	}
+	return 0
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	containerIDPattern      = regexp.MustCompile(`[0-9a-f]{64}`)
+	mountContainerIDPattern = regexp.MustCompile(`/containers/([0-9a-f]{64})/`)
+	shortIDPattern          = regexp.MustCompile(`^[0-9a-f]{12}$`)
+)
+
+// selfContainerID returns the ID of the container the exporter runs in, or
+// its prefix, or an empty string when not running in a container. The ID is
+// found in the cgroup of the exporter on cgroup v1 hosts, in the paths of
+// the files mounted by Docker such as /etc/hostname on cgroup v2 hosts, or
+// else in the hostname when it is the default short ID.
+func selfContainerID() string {
+	if data, err := os.ReadFile("/proc/self/cgroup"); err == nil {
+		if id := containerIDPattern.FindString(string(data)); id != "" {
+			return id
+		}
+	}
+	if data, err := os.ReadFile("/proc/self/mountinfo"); err == nil {
+		if match := mountContainerIDPattern.FindStringSubmatch(string(data)); match != nil {
+			return match[1]
+		}
+	}
+	if _, err := os.Stat("/.dockerenv"); err != nil {
+		return ""
+	}
+	if hostname, err := os.Hostname(); err == nil && shortIDPattern.MatchString(hostname) {
+		return hostname
+	}
+	return ""
+}
+
+// isSelf reports whether a container is the container of the exporter.
+func (e *exporter) isSelf(containerID string) bool {
+	return e.selfID != "" && strings.HasPrefix(containerID, e.selfID)
+}
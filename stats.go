@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// statsModeOneShot reads a single stats sample, which is cheap for the
+	// daemon but only allows exporting counters.
+	statsModeOneShot = "oneshot"
+	// statsModeTwoSample reads two stats samples about one second apart,
+	// which allows computing CPU usage percentage and per-second rates.
+	statsModeTwoSample = "twosample"
+	// statsModePrevious reads a single stats sample, computing CPU usage
+	// percentage and per-second rates against the sample of the previous
+	// collection.
+	statsModePrevious = "previous"
+)
+
+// statsHistory keeps the last stats sample of each container, for the
+// previous stats mode.
+type statsHistory struct {
+	mu   sync.Mutex
+	byID map[string]*types.StatsJSON
+}
+
+func newStatsHistory() *statsHistory {
+	return &statsHistory{byID: make(map[string]*types.StatsJSON)}
+}
+
+// swap stores the current stats sample of a container, returning the
+// previous one.
+func (h *statsHistory) swap(containerID string, stats *types.StatsJSON) *types.StatsJSON {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	previous := h.byID[containerID]
+	h.byID[containerID] = stats
+	return previous
+}
+
+// retain removes the stats samples of containers not in containers.
+func (h *statsHistory) retain(containers []types.Container) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	listed := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		listed[container.ID] = true
+	}
+	for id := range h.byID {
+		if !listed[id] {
+			delete(h.byID, id)
+		}
+	}
+}
+
+// containerStats returns the current stats of a container and, in the
+// two-sample and previous stats modes, the stats sampled before them.
+func (e *exporter) containerStats(ctx context.Context, containerID string) (stats, previous *types.StatsJSON, err error) {
+	if e.statsMode != statsModeTwoSample {
+		statsReader, err := e.docker.ContainerStatsOneShot(ctx, containerID)
+		if err != nil {
+			return nil, nil, &collectError{reasonStats, fmt.Errorf("cannot get stats: %v", err)}
+		}
+		defer statsReader.Body.Close()
+		stats = new(types.StatsJSON)
+		if err := json.NewDecoder(statsReader.Body).Decode(stats); err != nil {
+			return nil, nil, &collectError{reasonDecode, fmt.Errorf("cannot decode stats: %v", err)}
+		}
+		if e.statsMode == statsModePrevious {
+			previous = e.statsHistory.swap(containerID, stats)
+		}
+		return stats, previous, nil
+	}
+
+	statsReader, err := e.docker.ContainerStats(ctx, containerID, true)
+	if err != nil {
+		return nil, nil, &collectError{reasonStats, fmt.Errorf("cannot get stats: %v", err)}
+	}
+	defer statsReader.Body.Close()
+	decoder := json.NewDecoder(statsReader.Body)
+	previous, stats = new(types.StatsJSON), new(types.StatsJSON)
+	if err := decoder.Decode(previous); err != nil {
+		return nil, nil, &collectError{reasonDecode, fmt.Errorf("cannot decode stats: %v", err)}
+	}
+	if err := decoder.Decode(stats); err != nil {
+		return nil, nil, &collectError{reasonDecode, fmt.Errorf("cannot decode stats: %v", err)}
+	}
+	return stats, previous, nil
+}
+
+// collectRates exports the CPU usage percentage and per-second rates
+// computed between two stats samples.
+func collectRates(m *containerMetrics, stats, previous *types.StatsJSON) {
+	seconds := stats.Read.Sub(previous.Read).Seconds()
+	if seconds <= 0 {
+		return
+	}
+	rate := func(current, previous uint64) float64 {
+		if current < previous {
+			return 0
+		}
+		return float64(current-previous) / seconds
+	}
+
+	// CPU
+	{
+		cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(previous.CPUStats.CPUUsage.TotalUsage)
+		systemDelta := float64(stats.CPUStats.SystemUsage) - float64(previous.CPUStats.SystemUsage)
+		onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+		if onlineCPUs == 0 {
+			onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+		}
+		percent := 0.0
+		if cpuDelta > 0 && systemDelta > 0 {
+			percent = cpuDelta / systemDelta * onlineCPUs * 100
+		}
+
+		m.send("docker_container_cpu_usage_percent", prometheus.GaugeValue, percent)
+
+		m.send("docker_container_cpu_seconds_rate", prometheus.GaugeValue, rate(stats.CPUStats.CPUUsage.TotalUsage, previous.CPUStats.CPUUsage.TotalUsage)/float64(time.Second))
+	}
+
+	// Network
+	{
+		rxBytes, txBytes := networkBytes(stats)
+		previousRxBytes, previousTxBytes := networkBytes(previous)
+
+		m.send("docker_container_network_rx_bytes_rate", prometheus.GaugeValue, rate(rxBytes, previousRxBytes))
+
+		m.send("docker_container_network_tx_bytes_rate", prometheus.GaugeValue, rate(txBytes, previousTxBytes))
+	}
+
+	// Block I/O, skipped when only the current stats are filled from io.stat
+	// as in the twosample stats mode
+	if len(stats.BlkioStats.IoServiceBytesRecursive) == 0 || len(previous.BlkioStats.IoServiceBytesRecursive) > 0 {
+		readBytes, writeBytes := blkioBytes(stats)
+		previousReadBytes, previousWriteBytes := blkioBytes(previous)
+
+		m.send("docker_container_blkio_read_bytes_rate", prometheus.GaugeValue, rate(readBytes, previousReadBytes))
+
+		m.send("docker_container_blkio_write_bytes_rate", prometheus.GaugeValue, rate(writeBytes, previousWriteBytes))
+	}
+}
+
+// networkCounters are the counters of the network stats of containers.
+var networkCounters = []struct {
+	name  string
+	value func(network types.NetworkStats) uint64
+}{
+	{"docker_container_network_rx_bytes_total", func(network types.NetworkStats) uint64 { return network.RxBytes }},
+	{"docker_container_network_tx_bytes_total", func(network types.NetworkStats) uint64 { return network.TxBytes }},
+	{"docker_container_network_rx_packets_total", func(network types.NetworkStats) uint64 { return network.RxPackets }},
+	{"docker_container_network_tx_packets_total", func(network types.NetworkStats) uint64 { return network.TxPackets }},
+	{"docker_container_network_rx_errors_total", func(network types.NetworkStats) uint64 { return network.RxErrors }},
+	{"docker_container_network_tx_errors_total", func(network types.NetworkStats) uint64 { return network.TxErrors }},
+	{"docker_container_network_rx_dropped_total", func(network types.NetworkStats) uint64 { return network.RxDropped }},
+	{"docker_container_network_tx_dropped_total", func(network types.NetworkStats) uint64 { return network.TxDropped }},
+}
+
+// collectNetwork exports the bytes, packets, errors and drops received and
+// transmitted by a container, summed across its networks or for each
+// interface when NETWORK_PER_INTERFACE is enabled.
+func collectNetwork(m *containerMetrics, stats *types.StatsJSON) {
+	if !m.e.networkPerIface {
+		for _, counter := range networkCounters {
+			var value uint64
+			for _, network := range stats.Networks {
+				value += counter.value(network)
+			}
+			m.send(counter.name, prometheus.CounterValue, float64(value))
+		}
+		return
+	}
+
+	interfaces := make([]string, 0, len(stats.Networks))
+	for name := range stats.Networks {
+		interfaces = append(interfaces, name)
+	}
+	sort.Strings(interfaces)
+	for _, counter := range networkCounters {
+		for _, name := range interfaces {
+			m.sendWithLabels(counter.name, prometheus.CounterValue, float64(counter.value(stats.Networks[name])),
+				[]string{"interface"},
+				name)
+		}
+	}
+}
+
+// networkBytes returns the bytes received and transmitted across all the
+// networks of a container.
+func networkBytes(stats *types.StatsJSON) (rxBytes, txBytes uint64) {
+	for _, network := range stats.Networks {
+		rxBytes += network.RxBytes
+		txBytes += network.TxBytes
+	}
+	return rxBytes, txBytes
+}
+
+// blkioOps are the operations of the blkio stats of cgroup v1, exported in
+// lowercase in the op label. They are capitalized in the stats, such as
+// "Read", and lowercase on cgroup v2, which only has read and write.
+var blkioOps = []string{"read", "write", "sync", "async", "discard", "total"}
+
+// blkioBytes returns the bytes read and written across all the block devices
+// of a container.
+func blkioBytes(stats *types.StatsJSON) (readBytes, writeBytes uint64) {
+	readBytes, _ = blkioOp(stats.BlkioStats.IoServiceBytesRecursive, "read")
+	writeBytes, _ = blkioOp(stats.BlkioStats.IoServiceBytesRecursive, "write")
+	return readBytes, writeBytes
+}
+
+// blkioOp returns the sum of the values of an operation across all the block
+// devices of blkio stats, and whether the operation is reported at all. The
+// operations are capitalized on cgroup v1 and lowercase on cgroup v2.
+func blkioOp(entries []types.BlkioStatEntry, op string) (value uint64, ok bool) {
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Op, op) {
+			value += entry.Value
+			ok = true
+		}
+	}
+	return value, ok
+}
+
+// memoryBreakdown are the memory stats exported as metrics by their cgroup v1
+// and v2 keys, the latter empty for stats only reported on cgroup v1.
+var memoryBreakdown = []struct {
+	name      string
+	valueType prometheus.ValueType
+	v1Key     string
+	v2Key     string
+}{
+	{"docker_container_memory_cache_bytes", prometheus.GaugeValue, "total_cache", "file"},
+	{"docker_container_memory_swap_bytes", prometheus.GaugeValue, "total_swap", ""},
+	{"docker_container_memory_mapped_file_bytes", prometheus.GaugeValue, "total_mapped_file", "file_mapped"},
+	{"docker_container_memory_active_anon_bytes", prometheus.GaugeValue, "total_active_anon", "active_anon"},
+	{"docker_container_memory_inactive_anon_bytes", prometheus.GaugeValue, "total_inactive_anon", "inactive_anon"},
+	{"docker_container_memory_active_file_bytes", prometheus.GaugeValue, "total_active_file", "active_file"},
+	{"docker_container_memory_inactive_file_bytes", prometheus.GaugeValue, "total_inactive_file", "inactive_file"},
+	{"docker_container_memory_page_faults_total", prometheus.CounterValue, "total_pgfault", "pgfault"},
+	{"docker_container_memory_major_page_faults_total", prometheus.CounterValue, "total_pgmajfault", "pgmajfault"},
+}
+
+// memoryStat returns a memory stat by its cgroup v1 key, falling back to its
+// cgroup v2 key.
+func memoryStat(stats *types.StatsJSON, v1Key, v2Key string) (uint64, bool) {
+	if value, ok := stats.MemoryStats.Stats[v1Key]; ok {
+		return value, true
+	}
+	value, ok := stats.MemoryStats.Stats[v2Key]
+	return value, ok
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metricsSubset is a subset of the metrics served at /metrics/<name>.
+type metricsSubset struct {
+	name     string
+	patterns []string
+}
+
+// parseMetricsSubsets parses the subsets of metrics defined by
+// METRICS_PATH_<name> environment variables, with comma-separated patterns
+// of metric names.
+func parseMetricsSubsets(environ []string) ([]metricsSubset, error) {
+	const prefix = "METRICS_PATH_"
+	subsets := []metricsSubset{}
+	for _, env := range environ {
+		name, value, _ := strings.Cut(env, "=")
+		name, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		if name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid metrics path name %q", name)
+		}
+		subset := metricsSubset{name: name}
+		for _, pattern := range strings.Split(value, ",") {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" {
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q of metrics path %s: %v", pattern, name, err)
+			}
+			subset.patterns = append(subset.patterns, pattern)
+		}
+		if len(subset.patterns) == 0 {
+			return nil, fmt.Errorf("no patterns for metrics path %s", name)
+		}
+		subsets = append(subsets, subset)
+	}
+	sort.Slice(subsets, func(i, j int) bool { return subsets[i].name < subsets[j].name })
+	return subsets, nil
+}
+
+// statsMetrics are the prefixes of the names of the container metrics
+// collected from the stats of containers or after them.
+var statsMetrics = []string{
+	"docker_container_blkio_",
+	"docker_container_conntrack_",
+	"docker_container_cpu_",
+	"docker_container_file_descriptors",
+	"docker_container_memory_",
+	"docker_container_network_",
+	"docker_container_pids",
+	"docker_container_probe_",
+	"docker_container_processes",
+	"docker_container_threads",
+	"docker_group_",
+}
+
+// wants reports whether metrics whose name starts with any of the prefixes
+// are to be served, so that collectors are skipped when no metric they
+// collect is in the subset served.
+func (opts collectOptions) wants(prefixes ...string) bool {
+	if len(opts.metrics) == 0 {
+		return true
+	}
+	for _, pattern := range opts.metrics {
+		for _, prefix := range prefixes {
+			if matchesPrefix(pattern, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesPrefix reports whether a pattern may match names starting with the
+// prefix, assuming it does for character classes.
+func matchesPrefix(pattern, prefix string) bool {
+	for i := 0; i < len(prefix); i++ {
+		if pattern == "" {
+			return false
+		}
+		switch pattern[0] {
+		case '*', '[':
+			return true
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+		case '?':
+			pattern = pattern[1:]
+			continue
+		}
+		if pattern[0] != prefix[i] {
+			return false
+		}
+		pattern = pattern[1:]
+	}
+	return true
+}
+
+// filteredGatherer gathers the metric families whose name matches any of
+// the patterns.
+type filteredGatherer struct {
+	prometheus.Gatherer
+	patterns []string
+}
+
+func (g *filteredGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	filtered := families[:0]
+	for _, family := range families {
+		for _, pattern := range g.patterns {
+			if matched, _ := path.Match(pattern, family.GetName()); matched {
+				filtered = append(filtered, family)
+				break
+			}
+		}
+	}
+	return filtered, err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// target is a container observed by the exporter.
+type target struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	State         string     `json:"state"`
+	Excluded      string     `json:"excluded,omitempty"`
+	LastCollected *time.Time `json:"last_collected,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// targetList keeps track of the containers observed by the exporter and the
+// result of their last collection.
+type targetList struct {
+	mu   sync.Mutex
+	byID map[string]*target
+}
+
+func newTargetList() *targetList {
+	return &targetList{byID: make(map[string]*target)}
+}
+
+// observe replaces the observed containers with the result of a container
+// list, keeping the last collection result of containers still present.
+func (l *targetList) observe(containers []types.Container, exclusionReason func(*types.Container) string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	byID := make(map[string]*target, len(containers))
+	for i := range containers {
+		container := &containers[i]
+		t, ok := l.byID[container.ID]
+		if !ok {
+			t = &target{ID: container.ID}
+		}
+		t.Name = containerName(container)
+		t.State = container.State
+		t.Excluded = exclusionReason(container)
+		byID[container.ID] = t
+	}
+	l.byID = byID
+}
+
+// collected records the result of the collection of a container.
+func (l *targetList) collected(containerID string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if t, ok := l.byID[containerID]; ok {
+		now := time.Now()
+		t.LastCollected = &now
+		t.LastError = ""
+		if err != nil {
+			t.LastError = err.Error()
+		}
+	}
+}
+
+func (l *targetList) list() []target {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	targets := make([]target, 0, len(l.byID))
+	for _, t := range l.byID {
+		targets = append(targets, *t)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+	return targets
+}
+
+var targetsTemplate = template.Must(template.New("targets").Parse(`<!DOCTYPE html>
+<title>Targets</title>
+<table>
+<tr><th>Name</th><th>State</th><th>Excluded</th><th>Last Collected</th><th>Last Error</th></tr>
+{{range .}}<tr><td>{{.Name}}</td><td>{{.State}}</td><td>{{.Excluded}}</td><td>{{if .LastCollected}}{{.LastCollected.Format "2006-01-02 15:04:05"}}{{end}}</td><td>{{.LastError}}</td></tr>
+{{end}}</table>
+`))
+
+// newTargetsHandler serves the observed containers as JSON, or as an HTML
+// page for browsers.
+func newTargetsHandler(l *targetList) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		targets := l.list()
+		if strings.Contains(r.Header.Get("Accept"), "text/html") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			targetsTemplate.Execute(w, targets)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(targets)
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+const topDefaultN = 10
+
+// topMetrics are the metrics containers can be ranked by.
+var topMetrics = []string{"cpu", "memory", "pids"}
+
+// topEntry is the latest collected usage of a container.
+type topEntry struct {
+	name        string
+	cpuPercent  float64
+	memoryBytes float64
+	pids        float64
+
+	cpuSeconds float64
+	read       time.Time
+}
+
+// topList keeps the latest collected usage of the running containers, to
+// rank them without querying the Docker daemon.
+type topList struct {
+	mu   sync.Mutex
+	byID map[string]*topEntry
+}
+
+func newTopList() *topList {
+	return &topList{byID: make(map[string]*topEntry)}
+}
+
+// observe records the usage of a container, computing its CPU usage
+// percentage since its previous collection.
+func (l *topList) observe(container *types.Container, stats *types.StatsJSON, memoryBytes uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.byID[container.ID]
+	if !ok {
+		entry = &topEntry{}
+		l.byID[container.ID] = entry
+	}
+	cpuSeconds := nsToS(stats.CPUStats.CPUUsage.TotalUsage)
+	if seconds := stats.Read.Sub(entry.read).Seconds(); ok && seconds > 0 && cpuSeconds >= entry.cpuSeconds {
+		entry.cpuPercent = (cpuSeconds - entry.cpuSeconds) / seconds * 100
+	}
+	entry.name = containerName(container)
+	entry.memoryBytes = float64(memoryBytes)
+	entry.pids = float64(stats.PidsStats.Current)
+	entry.cpuSeconds = cpuSeconds
+	entry.read = stats.Read
+}
+
+// retain removes the usage of containers not in containers.
+func (l *topList) retain(containers []types.Container) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	running := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		running[container.ID] = container.State == "running"
+	}
+	for id := range l.byID {
+		if !running[id] {
+			delete(l.byID, id)
+		}
+	}
+}
+
+// topContainer is a container ranked by a metric.
+type topContainer struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// top returns the n containers with the highest value of a metric.
+func (l *topList) top(metric string, n int) []topContainer {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ranked := make([]topContainer, 0, len(l.byID))
+	for _, entry := range l.byID {
+		value := entry.memoryBytes
+		switch metric {
+		case "cpu":
+			value = entry.cpuPercent
+		case "pids":
+			value = entry.pids
+		}
+		ranked = append(ranked, topContainer{entry.name, value})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Value != ranked[j].Value {
+			return ranked[i].Value > ranked[j].Value
+		}
+		return ranked[i].Name < ranked[j].Name
+	})
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
+var topTemplate = template.Must(template.New("top").Parse(`<!DOCTYPE html>
+<title>Top Containers by {{.Metric}}</title>
+<table>
+<tr><th>Name</th><th>{{.Metric}}</th></tr>
+{{range .Containers}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+`))
+
+// newTopHandler serves the containers with the highest CPU usage
+// percentage, memory usage, or number of PIDs as JSON, or as an HTML page for
+// browsers, at /top?metric=<metric>&n=<n>.
+func newTopHandler(l *topList) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metric := r.URL.Query().Get("metric")
+		if metric == "" {
+			metric = "memory"
+		}
+		valid := false
+		for _, topMetric := range topMetrics {
+			valid = valid || metric == topMetric
+		}
+		if !valid {
+			http.Error(w, fmt.Sprintf("invalid metric %q: must be %s", metric, strings.Join(topMetrics, ", ")), http.StatusBadRequest)
+			return
+		}
+		n := topDefaultN
+		if r.URL.Query().Get("n") != "" {
+			var err error
+			n, err = strconv.Atoi(r.URL.Query().Get("n"))
+			if err != nil || n <= 0 {
+				http.Error(w, fmt.Sprintf("invalid n %q: must be a positive integer", r.URL.Query().Get("n")), http.StatusBadRequest)
+				return
+			}
+		}
+
+		containers := l.top(metric, n)
+		if strings.Contains(r.Header.Get("Accept"), "text/html") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			topTemplate.Execute(w, struct {
+				Metric     string
+				Containers []topContainer
+			}{metric, containers})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(containers)
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// urlLabelPrefix is the prefix of the URL parameters of scrape requests
+// adding a constant label to the metrics of the response.
+const urlLabelPrefix = "label_"
+
+// parseURLLabels returns the constant labels of the label_<name>=<value>
+// parameters of a scrape request.
+func parseURLLabels(query url.Values) ([]*dto.LabelPair, error) {
+	labels := []*dto.LabelPair{}
+	for key, values := range query {
+		name, ok := strings.CutPrefix(key, urlLabelPrefix)
+		if !ok {
+			continue
+		}
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			return nil, fmt.Errorf("invalid label name %q", name)
+		}
+		if len(values) != 1 {
+			return nil, fmt.Errorf("multiple values for label %s", name)
+		}
+		name, value := name, values[0]
+		labels = append(labels, &dto.LabelPair{Name: &name, Value: &value})
+	}
+	return labels, nil
+}
+
+// labeledGatherer adds constant labels to all the metrics gathered, failing
+// for metrics which already have one of the labels.
+type labeledGatherer struct {
+	prometheus.Gatherer
+	labels []*dto.LabelPair
+}
+
+func (g *labeledGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				for _, extra := range g.labels {
+					if label.GetName() == extra.GetName() {
+						return nil, fmt.Errorf("label %s of the scrape request conflicts with the label of %s", extra.GetName(), family.GetName())
+					}
+				}
+			}
+			metric.Label = append(metric.Label, g.labels...)
+			sort.Slice(metric.Label, func(i, j int) bool { return metric.Label[i].GetName() < metric.Label[j].GetName() })
+		}
+	}
+	return families, err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const warmUpTimeout = time.Minute
+
+// warmUp runs a collection round right after startup, before the first
+// scrape, so that the caches and previous stats of the exporter are filled
+// and the problems of the configuration with the containers of the host are
+// logged immediately. Errors of label templates, which are exported as empty
+// values by scrapes, are logged once for each label by the collection.
+func (e *exporter) warmUp() {
+	ctx, cancel := context.WithTimeout(context.Background(), warmUpTimeout)
+	defer cancel()
+
+	start := time.Now()
+	ch := make(chan prometheus.Metric)
+	done := make(chan int)
+	go func() {
+		n := 0
+		for range ch {
+			n++
+		}
+		done <- n
+	}()
+	e.collect(ctx, ch, collectOptions{templateErrors: &templateErrors{}})
+	close(ch)
+	log.Printf("Warm-up collection of %d metrics took %v", <-done, time.Since(start).Round(time.Millisecond))
+}
+
+// templateErrors logs the errors of label templates of a collection, once
+// for each label.
+type templateErrors struct {
+	mu     sync.Mutex
+	failed map[string]bool
+}
+
+func (t *templateErrors) add(label string, container *types.Container, err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.failed[label] {
+		return
+	}
+	if t.failed == nil {
+		t.failed = make(map[string]bool)
+	}
+	t.failed[label] = true
+	log.Printf("template for label %s failed on container %s: %v", label, containerName(container), err)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectWindowsStats exports the stats of a Windows container, which are
+// reported in different fields than the ones of Linux containers.
+func collectWindowsStats(m *containerMetrics, stats *types.StatsJSON) {
+	// CPU, in 100ns intervals
+	m.send("docker_container_cpu_seconds_total", prometheus.CounterValue, float64(stats.CPUStats.CPUUsage.TotalUsage)/1e7)
+
+	// Memory
+	m.send("docker_container_memory_usage_bytes", prometheus.GaugeValue, float64(stats.MemoryStats.PrivateWorkingSet))
+	m.send("docker_container_memory_commit_bytes", prometheus.GaugeValue, float64(stats.MemoryStats.Commit))
+	m.send("docker_container_memory_commit_peak_bytes", prometheus.GaugeValue, float64(stats.MemoryStats.CommitPeak))
+
+	// Network
+	collectNetwork(m, stats)
+
+	// Storage
+	m.send("docker_container_blkio_read_bytes_total", prometheus.CounterValue, float64(stats.StorageStats.ReadSizeBytes))
+	m.send("docker_container_blkio_write_bytes_total", prometheus.CounterValue, float64(stats.StorageStats.WriteSizeBytes))
+	m.send("docker_container_blkio_reads_total", prometheus.CounterValue, float64(stats.StorageStats.ReadCountNormalized))
+	m.send("docker_container_blkio_writes_total", prometheus.CounterValue, float64(stats.StorageStats.WriteCountNormalized))
+
+	// Processes
+	m.send("docker_container_pids", prometheus.GaugeValue, float64(stats.NumProcs))
+}